@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/handler"
+	"github.com/darkdragonsastro/weewx-json-alpaca/mdns"
+)
+
+// advertisement keeps the mDNS advertisement in line with the configuration.
+type advertisement struct {
+	advertiser *mdns.Advertiser
+}
+
+func startAdvertisement(c config, id uuid.UUID, h *handler.Handler, log *zap.Logger) (*advertisement, error) {
+	advertiser, err := mdns.Start(mdnsInfo(c, id, h), log)
+	if err != nil {
+		return nil, err
+	}
+
+	return &advertisement{advertiser: advertiser}, nil
+}
+
+// configure applies a reloaded configuration. Only the mDNS name is taken
+// from it; the rest needs a restart.
+func (a *advertisement) configure(c config) {
+	a.advertiser.Rename(mdnsName(c))
+}
+
+func (a *advertisement) stop() {
+	a.advertiser.Stop()
+}
+
+// mdnsInfo returns what to advertise over mDNS for the devices served by h.
+func mdnsInfo(c config, id uuid.UUID, h *handler.Handler) mdns.Info {
+	configured := h.Configured()
+
+	info := mdns.Info{
+		Instance:    mdnsName(c),
+		Port:        c.ListenPort,
+		UniqueID:    id.String(),
+		APIVersions: []int{1},
+	}
+
+	for _, d := range configured {
+		info.DeviceTypes = append(info.DeviceTypes, d.DeviceType)
+	}
+
+	return info
+}
+
+// mdnsName returns the service instance name: MDNS_NAME, or the server name
+// and the host name.
+func mdnsName(c config) string {
+	if c.MDNSName != "" {
+		return c.MDNSName
+	}
+
+	name := c.ServerName
+	if host, err := os.Hostname(); err == nil {
+		name += " on " + host
+	}
+
+	return name
+}
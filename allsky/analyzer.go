@@ -0,0 +1,201 @@
+package allsky
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/fits"
+	"github.com/darkdragonsastro/weewx-json-alpaca/stars"
+)
+
+// Options configures the analyzer.
+type Options struct {
+	// MaskPath is an image the size of the camera frames. Bright pixels are
+	// sky, dark pixels are horizon or obstructions. When empty, the largest
+	// circle centered in the frame is used.
+	MaskPath string
+	// Threshold is the star detection threshold in standard deviations of the
+	// sky background.
+	Threshold float64
+	// ZenithRadius is the radius of the zenith region as a fraction of the
+	// sky circle radius.
+	ZenithRadius float64
+	// ExpectedStars is the number of stars detected in the zenith region on a
+	// clear, moonless night.
+	ExpectedStars int
+}
+
+// Result is the analysis of a single frame.
+type Result struct {
+	Timestamp time.Time
+	// Stars is the number of stars detected in the zenith region.
+	Stars int
+	// CloudCover is the estimated cloud cover in percent.
+	CloudCover float64
+	// SkyBrightness is the median sky pixel value as a fraction of the
+	// maximum pixel value. It depends on the exposure, so it is only
+	// comparable between frames taken with the same settings.
+	SkyBrightness float64
+}
+
+// Analyzer estimates cloud cover and sky brightness from all-sky frames.
+type Analyzer struct {
+	opts Options
+
+	// mask is loaded lazily, since the frame size is not known up front when
+	// no mask image is configured.
+	mask         []bool
+	maskW, maskH int
+}
+
+// NewAnalyzer creates a new analyzer, loading the mask image if configured.
+func NewAnalyzer(opts Options) (*Analyzer, error) {
+	if opts.ExpectedStars <= 0 {
+		return nil, errors.New("expected stars must be greater than zero")
+	}
+
+	if opts.ZenithRadius <= 0 || opts.ZenithRadius > 1 {
+		return nil, fmt.Errorf("zenith radius %v must be between 0 and 1", opts.ZenithRadius)
+	}
+
+	a := &Analyzer{opts: opts}
+
+	if opts.MaskPath != "" {
+		img, maxValue, err := LoadImage(opts.MaskPath)
+		if err != nil {
+			return nil, fmt.Errorf("loading mask: %w", err)
+		}
+
+		a.mask = make([]bool, len(img.Pixels))
+		for i, v := range img.Pixels {
+			a.mask[i] = v > maxValue/2
+		}
+		a.maskW, a.maskH = img.Width, img.Height
+	}
+
+	return a, nil
+}
+
+// AnalyzeFile loads and analyzes the frame at path.
+func (a *Analyzer) AnalyzeFile(path string) (*Result, error) {
+	img, maxValue, err := LoadImage(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.Analyze(img, maxValue)
+}
+
+// Analyze counts the stars in the zenith region of the frame and compares
+// them with the number expected on a clear night.
+func (a *Analyzer) Analyze(img *fits.Image, maxValue float64) (*Result, error) {
+	mask, err := a.maskFor(img)
+	if err != nil {
+		return nil, err
+	}
+
+	cx, cy, radius := circle(mask, img.Width, img.Height)
+	if radius == 0 {
+		return nil, errors.New("mask has no sky pixels")
+	}
+
+	var sky []float64
+	for i, v := range img.Pixels {
+		if mask[i] {
+			sky = append(sky, v)
+		}
+	}
+
+	// Replace the masked pixels with sky pixels, so the horizon skews neither
+	// the background level nor its noise. A constant fill would make the
+	// noise look smaller and let it through as stars. Stars copied into the
+	// horizon are outside the zenith region and not counted.
+	masked := &fits.Image{
+		Width:  img.Width,
+		Height: img.Height,
+		Pixels: make([]float64, len(img.Pixels)),
+	}
+	j := 0
+	for i, v := range img.Pixels {
+		if mask[i] {
+			masked.Pixels[i] = v
+		} else {
+			masked.Pixels[i] = sky[j%len(sky)]
+			j++
+		}
+	}
+
+	sort.Float64s(sky)
+	level := sky[len(sky)/2]
+
+	opts := stars.DefaultOptions()
+	opts.Threshold = a.opts.Threshold
+	opts.Radius = 3
+	opts.Saturation = maxValue
+
+	zenith := a.opts.ZenithRadius * radius
+
+	n := 0
+	for _, p := range stars.Peaks(masked, opts) {
+		if math.Hypot(p.X-cx, p.Y-cy) <= zenith {
+			n++
+		}
+	}
+
+	visible := math.Min(float64(n)/float64(a.opts.ExpectedStars), 1)
+
+	return &Result{
+		Timestamp:     time.Now(),
+		Stars:         n,
+		CloudCover:    100 * (1 - visible),
+		SkyBrightness: level / maxValue,
+	}, nil
+}
+
+func (a *Analyzer) maskFor(img *fits.Image) ([]bool, error) {
+	if a.mask != nil {
+		if a.maskW != img.Width || a.maskH != img.Height {
+			return nil, fmt.Errorf("mask is %dx%d but the frame is %dx%d", a.maskW, a.maskH, img.Width, img.Height)
+		}
+
+		return a.mask, nil
+	}
+
+	mask := make([]bool, img.Width*img.Height)
+
+	cx, cy := float64(img.Width-1)/2, float64(img.Height-1)/2
+	r := math.Min(float64(img.Width), float64(img.Height)) / 2
+
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			mask[y*img.Width+x] = math.Hypot(float64(x)-cx, float64(y)-cy) <= r
+		}
+	}
+
+	return mask, nil
+}
+
+// circle returns the center and radius of the sky region of the mask. The
+// center is the centroid of the sky pixels, and the radius that of a circle
+// of the same area.
+func circle(mask []bool, width, height int) (cx, cy, radius float64) {
+	n := 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if mask[y*width+x] {
+				cx += float64(x)
+				cy += float64(y)
+				n++
+			}
+		}
+	}
+
+	if n == 0 {
+		return 0, 0, 0
+	}
+
+	return cx / float64(n), cy / float64(n), math.Sqrt(float64(n) / math.Pi)
+}
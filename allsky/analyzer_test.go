@@ -0,0 +1,102 @@
+package allsky
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/fits"
+)
+
+// skyFrame renders a noisy sky with a star at each position.
+func skyFrame(width, height int, background float64, positions [][2]float64) *fits.Image {
+	rnd := rand.New(rand.NewSource(1))
+
+	img := &fits.Image{
+		Width:  width,
+		Height: height,
+		Pixels: make([]float64, width*height),
+		Header: map[string]string{},
+	}
+
+	for i := range img.Pixels {
+		img.Pixels[i] = background + rnd.NormFloat64()*10
+	}
+
+	const sigma = 1.2
+	for _, p := range positions {
+		for y := int(p[1]) - 6; y <= int(p[1])+6; y++ {
+			for x := int(p[0]) - 6; x <= int(p[0])+6; x++ {
+				dx, dy := float64(x)-p[0], float64(y)-p[1]
+				img.Pixels[y*width+x] += 5000 * math.Exp(-(dx*dx+dy*dy)/(2*sigma*sigma))
+			}
+		}
+	}
+
+	return img
+}
+
+func TestAnalyze(t *testing.T) {
+	// The sky is the circle of radius 100 centered in the frame, and the
+	// zenith region the inner half of it.
+	var zenith [][2]float64
+	for y := 70.0; y <= 130; y += 15 {
+		for x := 85.0; x <= 115; x += 15 {
+			zenith = append(zenith, [2]float64{x, y})
+		}
+	}
+
+	// Stars near the horizon are not counted.
+	horizon := [][2]float64{{100, 20}, {100, 180}, {20, 100}}
+
+	tests := []struct {
+		name      string
+		positions [][2]float64
+		expected  int
+		cover     float64
+	}{
+		{"clear", zenith, len(zenith), 0},
+		{"half", zenith, 2 * len(zenith), 50},
+		{"more stars than expected", zenith, len(zenith) / 3, 0},
+		{"horizon only", horizon, 10, 100},
+		{"overcast", nil, 10, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAnalyzer(Options{Threshold: 5, ZenithRadius: 0.5, ExpectedStars: tt.expected})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			img := skyFrame(200, 200, 1000, tt.positions)
+
+			r, err := a.Analyze(img, 65535)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if math.Abs(r.CloudCover-tt.cover) > 1e-9 {
+				t.Errorf("cloud cover %g with %d stars, want %g", r.CloudCover, r.Stars, tt.cover)
+			}
+
+			if math.Abs(r.SkyBrightness-1000.0/65535) > 1/65535.0 {
+				t.Errorf("sky brightness %g, want %g", r.SkyBrightness, 1000.0/65535)
+			}
+		})
+	}
+}
+
+func TestAnalyzeRejectsMismatchedMask(t *testing.T) {
+	a := &Analyzer{
+		opts:  Options{Threshold: 5, ZenithRadius: 0.5, ExpectedStars: 10},
+		mask:  make([]bool, 4),
+		maskW: 2,
+		maskH: 2,
+	}
+
+	_, err := a.Analyze(skyFrame(20, 20, 1000, nil), 65535)
+	if err == nil {
+		t.Error("analyzed a frame of another size than the mask")
+	}
+}
@@ -0,0 +1,169 @@
+package allsky
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Camera watches the directory an all-sky camera writes its frames into and
+// analyzes the newest frame.
+type Camera struct {
+	analyzer *Analyzer
+	dir      string
+	interval time.Duration
+	maxAge   time.Duration
+	log      *zap.Logger
+
+	result atomic.Pointer[Result]
+
+	// pending is the newest frame seen on the last scan. It is analyzed once
+	// it is unchanged on the next scan, so frames still being written are
+	// skipped.
+	pending   frame
+	processed frame
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+type frame struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// NewCamera creates a new camera. Results older than maxAge are not served.
+func NewCamera(analyzer *Analyzer, dir string, interval, maxAge time.Duration, log *zap.Logger) *Camera {
+	return &Camera{
+		analyzer: analyzer,
+		dir:      dir,
+		interval: interval,
+		maxAge:   maxAge,
+		log:      log,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start begins watching the directory.
+func (c *Camera) Start() error {
+	_, err := os.Stat(c.dir)
+	if err != nil {
+		return err
+	}
+
+	c.log.Info("starting all-sky camera", zap.String("dir", c.dir))
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.stop:
+				c.log.Info("stopping all-sky camera")
+				return
+			case <-ticker.C:
+				c.scan()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops watching and waits for the frame being analyzed to finish.
+func (c *Camera) Stop() {
+	close(c.stop)
+	c.wg.Wait()
+}
+
+// Current returns the latest analysis, or nil if there is none newer than
+// the maximum age.
+func (c *Camera) Current() *Result {
+	r := c.result.Load()
+	if r == nil || (c.maxAge > 0 && time.Since(r.Timestamp) > c.maxAge) {
+		return nil
+	}
+
+	return r
+}
+
+// CloudCover returns the estimated cloud cover in percent.
+func (c *Camera) CloudCover() *float64 {
+	r := c.Current()
+	if r == nil {
+		return nil
+	}
+
+	return &r.CloudCover
+}
+
+func (c *Camera) scan() {
+	newest, err := c.newest()
+	if err != nil {
+		c.log.Error("error scanning all-sky directory", zap.Error(err))
+		return
+	}
+
+	if newest == nil || *newest == c.processed {
+		return
+	}
+
+	if *newest != c.pending {
+		c.pending = *newest
+		return
+	}
+
+	c.processed = *newest
+
+	result, err := c.analyzer.AnalyzeFile(newest.path)
+	if err != nil {
+		c.log.Warn("error analyzing all-sky frame", zap.String("path", newest.path), zap.Error(err))
+		return
+	}
+
+	c.log.Info("analyzed all-sky frame",
+		zap.String("path", newest.path),
+		zap.Int("stars", result.Stars),
+		zap.Float64("cloud_cover", result.CloudCover),
+		zap.Float64("sky_brightness", result.SkyBrightness))
+
+	c.result.Store(result)
+}
+
+func (c *Camera) newest() (*frame, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var newest *frame
+	for _, e := range entries {
+		if e.IsDir() || !isImage(e.Name()) {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		if newest == nil || info.ModTime().After(newest.modTime) {
+			newest = &frame{
+				path:    filepath.Join(c.dir, e.Name()),
+				size:    info.Size(),
+				modTime: info.ModTime(),
+			}
+		}
+	}
+
+	return newest, nil
+}
@@ -0,0 +1,107 @@
+// Package allsky analyzes the images of an all-sky camera to estimate the
+// cloud cover and the relative sky brightness.
+package allsky
+
+import (
+	"image"
+	_ "image/jpeg" // register the JPEG decoder
+	_ "image/png"  // register the PNG decoder
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/fits"
+)
+
+// LoadImage loads a JPEG, PNG or FITS image as a single grayscale plane,
+// along with the maximum value a pixel can take.
+func LoadImage(path string) (*fits.Image, float64, error) {
+	if fits.IsFITS(path) {
+		img, err := fits.ReadFile(path)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return img, maxValue(img), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	decoded, _, err := image.Decode(f)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return gray(decoded), 65535, nil
+}
+
+// maxValue returns the largest value a pixel of the FITS image can take. For
+// integer data, this is the top of the BITPIX range scaled by BZERO and
+// BSCALE. Floating point data has no fixed range, so the brightest pixel is
+// used.
+func maxValue(img *fits.Image) float64 {
+	bitpix, _ := img.HeaderFloat("BITPIX")
+	if bitpix > 0 {
+		bzero, _ := img.HeaderFloat("BZERO")
+		bscale, ok := img.HeaderFloat("BSCALE")
+		if !ok {
+			bscale = 1
+		}
+
+		// 8-bit data is unsigned, the wider integers are signed.
+		top := math.Exp2(bitpix-1) - 1
+		if bitpix == 8 {
+			top = 255
+		}
+
+		return bzero + bscale*top
+	}
+
+	max := 0.0
+	for _, v := range img.Pixels {
+		max = math.Max(max, v)
+	}
+
+	if max <= 0 {
+		return 1
+	}
+
+	return max
+}
+
+// gray converts the image to luminance. Rows are flipped so that, as in FITS,
+// the first row is the bottom of the image.
+func gray(src image.Image) *fits.Image {
+	b := src.Bounds()
+
+	img := &fits.Image{
+		Width:  b.Dx(),
+		Height: b.Dy(),
+		Pixels: make([]float64, b.Dx()*b.Dy()),
+		Header: map[string]string{},
+	}
+
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			r, g, bl, _ := src.At(b.Min.X+x, b.Max.Y-1-y).RGBA()
+			img.Pixels[y*img.Width+x] = 0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(bl)
+		}
+	}
+
+	return img
+}
+
+// isImage reports whether the file name has an extension LoadImage supports.
+func isImage(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+
+	return fits.IsFITS(path)
+}
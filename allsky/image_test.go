@@ -0,0 +1,84 @@
+package allsky
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/fits"
+)
+
+func TestMaxValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		pixels []float64
+		want   float64
+	}{
+		{"8 bit", map[string]string{"BITPIX": "8"}, nil, 255},
+		{"signed 16 bit", map[string]string{"BITPIX": "16"}, nil, 32767},
+		{"unsigned 16 bit", map[string]string{"BITPIX": "16", "BZERO": "32768"}, nil, 65535},
+		{"scaled 16 bit", map[string]string{"BITPIX": "16", "BZERO": "0", "BSCALE": "0.5"}, nil, 16383.5},
+		{"unsigned 32 bit", map[string]string{"BITPIX": "32", "BZERO": "2147483648"}, nil, 4294967295},
+		{"floating point", map[string]string{"BITPIX": "-32"}, []float64{0.1, 0.75, 0.3}, 0.75},
+		{"black floating point", map[string]string{"BITPIX": "-64"}, []float64{0, 0}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := &fits.Image{Header: tt.header, Pixels: tt.pixels}
+
+			if got := maxValue(img); got != tt.want {
+				t.Errorf("maxValue = %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadImage(t *testing.T) {
+	dir := t.TempDir()
+
+	fitsPath := filepath.Join(dir, "frame.fits")
+	err := fits.WriteFile(fitsPath, &fits.Image{Width: 2, Height: 1, Pixels: []float64{100, 40000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, max, err := LoadImage(fitsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if max != 65535 || img.Pixels[0] != 100 || img.Pixels[1] != 40000 {
+		t.Errorf("FITS frame: pixels %v max %g, want [100 40000] max 65535", img.Pixels, max)
+	}
+
+	pngPath := filepath.Join(dir, "frame.png")
+	src := image.NewGray(image.Rect(0, 0, 1, 2))
+	src.SetGray(0, 0, color.Gray{Y: 255})
+	src.SetGray(0, 1, color.Gray{Y: 0})
+
+	f, err := os.Create(pngPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = png.Encode(f, src)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, max, err = LoadImage(pngPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rows are flipped, so the white top row comes last.
+	if max != 65535 || img.Pixels[0] != 0 || math.Abs(img.Pixels[1]-65535) > 1e-6 {
+		t.Errorf("PNG frame: pixels %v max %g, want [0 65535] max 65535", img.Pixels, max)
+	}
+}
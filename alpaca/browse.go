@@ -0,0 +1,288 @@
+package alpaca
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Server is an Alpaca server that answered a discovery probe.
+type Server struct {
+	// Addr is the IP address the reply came from.
+	Addr net.IP `json:"addr"`
+	// Zone is the interface of an IPv6 link-local address.
+	Zone string `json:"zone,omitempty"`
+	// Port is the port of the Alpaca API.
+	Port int `json:"alpaca_port"`
+}
+
+// BaseURL returns the URL of the server's Alpaca API.
+func (s Server) BaseURL() string {
+	host := s.Addr.String()
+	if s.Zone != "" {
+		host += "%25" + s.Zone
+	}
+
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(s.Port))
+}
+
+// DiscoverOptions configures Discover.
+type DiscoverOptions struct {
+	// Port is the discovery port, DefaultDiscoveryPort when zero.
+	Port int
+	// Timeout is how long to wait for replies.
+	Timeout time.Duration
+	// DisableIPv4 and DisableIPv6 skip probing over that protocol.
+	DisableIPv4 bool
+	DisableIPv6 bool
+}
+
+// Discover broadcasts a discovery probe on every interface, over IPv4 and to
+// the IPv6 discovery group, and returns the servers that answer before the
+// timeout. A server that answers on several addresses is listed once per
+// address.
+func Discover(ctx context.Context, opts DiscoverOptions) ([]Server, error) {
+	if opts.Port == 0 {
+		opts.Port = DefaultDiscoveryPort
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu      sync.Mutex
+		servers = make(map[string]Server)
+		wg      sync.WaitGroup
+		errs    []error
+		probed  int
+	)
+
+	probe := func(network string, targets []*net.UDPAddr) {
+		if len(targets) == 0 {
+			return
+		}
+
+		conn, err := net.ListenUDP(network, nil)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+
+		sent := 0
+		for _, t := range targets {
+			_, err = conn.WriteToUDP([]byte(DiscoveryProbe), t)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("probing %s: %w", t, err))
+				continue
+			}
+			sent++
+		}
+
+		if sent == 0 {
+			conn.Close()
+			return
+		}
+		probed++
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			<-ctx.Done()
+			conn.Close()
+		}()
+		go func() {
+			defer wg.Done()
+
+			buf := make([]byte, 256)
+			for {
+				n, addr, err := conn.ReadFromUDP(buf)
+				if err != nil {
+					return
+				}
+
+				var reply struct {
+					AlpacaPort int `json:"AlpacaPort"`
+				}
+				if json.Unmarshal(buf[:n], &reply) != nil || reply.AlpacaPort == 0 {
+					continue
+				}
+
+				s := Server{Addr: addr.IP, Zone: addr.Zone, Port: reply.AlpacaPort}
+
+				mu.Lock()
+				servers[s.BaseURL()] = s
+				mu.Unlock()
+			}
+		}()
+	}
+
+	if !opts.DisableIPv4 {
+		probe("udp4", broadcastTargets(ifaces, opts.Port))
+	}
+	if !opts.DisableIPv6 {
+		probe("udp6", multicastTargets(ifaces, opts.Port))
+	}
+
+	if probed == 0 {
+		if len(errs) == 0 {
+			return nil, errors.New("no interface to probe")
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	wg.Wait()
+
+	list := make([]Server, 0, len(servers))
+	for _, s := range servers {
+		list = append(list, s)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].BaseURL() < list[j].BaseURL()
+	})
+
+	return list, nil
+}
+
+// broadcastTargets returns the limited broadcast address and the broadcast
+// address of every IPv4 network of the interfaces.
+func broadcastTargets(ifaces []net.Interface, port int) []*net.UDPAddr {
+	targets := []*net.UDPAddr{{IP: net.IPv4bcast, Port: port}}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+
+			ip := ipnet.IP.To4()
+			if ip == nil {
+				continue
+			}
+
+			bcast := make(net.IP, net.IPv4len)
+			for i := range ip {
+				bcast[i] = ip[i] | ^ipnet.Mask[len(ipnet.Mask)-net.IPv4len+i]
+			}
+
+			targets = append(targets, &net.UDPAddr{IP: bcast, Port: port})
+		}
+	}
+
+	return targets
+}
+
+// multicastTargets returns the IPv6 discovery group on every multicast capable
+// interface.
+func multicastTargets(ifaces []net.Interface, port int) []*net.UDPAddr {
+	var targets []*net.UDPAddr
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+
+		targets = append(targets, &net.UDPAddr{IP: DiscoveryGroup, Port: port, Zone: iface.Name})
+	}
+
+	return targets
+}
+
+// Description is the description of an Alpaca server.
+type Description struct {
+	ServerName          string `json:"ServerName"`
+	Manufacturer        string `json:"Manufacturer"`
+	ManufacturerVersion string `json:"ManufacturerVersion"`
+	Location            string `json:"Location"`
+}
+
+// ConfiguredDevice is a device served by an Alpaca server.
+type ConfiguredDevice struct {
+	DeviceName   string `json:"DeviceName"`
+	DeviceType   string `json:"DeviceType"`
+	DeviceNumber int    `json:"DeviceNumber"`
+	UniqueID     string `json:"UniqueID"`
+}
+
+// GetDescription queries the management description of the server at
+// baseURL.
+func GetDescription(ctx context.Context, c *http.Client, baseURL string) (*Description, error) {
+	var d Description
+
+	err := getManagement(ctx, c, baseURL+"/management/v1/description", &d)
+	if err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// GetConfiguredDevices queries the devices served by the server at baseURL.
+func GetConfiguredDevices(ctx context.Context, c *http.Client, baseURL string) ([]ConfiguredDevice, error) {
+	var devices []ConfiguredDevice
+
+	err := getManagement(ctx, c, baseURL+"/management/v1/configureddevices", &devices)
+	if err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+func getManagement(ctx context.Context, c *http.Client, u string, value interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body := struct {
+		Value        interface{} `json:"Value"`
+		ErrorNumber  int         `json:"ErrorNumber"`
+		ErrorMessage string      `json:"ErrorMessage"`
+	}{
+		Value: value,
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return err
+	}
+
+	if body.ErrorNumber != 0 {
+		return fmt.Errorf("alpaca error 0x%X: %s", body.ErrorNumber, body.ErrorMessage)
+	}
+
+	return nil
+}
@@ -8,6 +8,9 @@ type AlpacaContext struct {
 	ServerTransactionID uint64
 	DeviceType          *string
 	DeviceNumber        *int
+
+	// Params are the parameters of the request.
+	Params Params
 }
 
 type contextKey string
@@ -1,73 +1,169 @@
 package alpaca
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
 )
 
+// DefaultDiscoveryPort is the UDP port Alpaca clients send discovery probes
+// to.
+const DefaultDiscoveryPort = 32227
+
+// DiscoveryProbe is the discovery request sent by Alpaca clients.
+const DiscoveryProbe = "alpacadiscovery1"
+
+// DiscoveryGroup is the IPv6 multicast group Alpaca clients send discovery
+// probes to.
+var DiscoveryGroup = net.ParseIP("ff12::a1:9aca")
+
+// duplicateWindow is how long a reply to a client suppresses further replies
+// to the same client. Every IPv6 listener receives a probe sent to the group,
+// so without it a host with several interfaces would answer several times.
+const duplicateWindow = 250 * time.Millisecond
+
 type AlpacaDiscovery struct {
-	log  *zap.Logger
-	port int
-	stop bool
+	log           *zap.Logger
+	port          int
+	discoveryPort int
+
+	mu      sync.Mutex
+	conns   []*net.UDPConn
+	replied map[string]time.Time
+	wg      sync.WaitGroup
 }
 
-func NewAlpacaDiscovery(log *zap.Logger, port int) *AlpacaDiscovery {
+// NewAlpacaDiscovery returns a discovery responder that advertises the Alpaca
+// API on port and listens for probes on discoveryPort.
+func NewAlpacaDiscovery(log *zap.Logger, port, discoveryPort int) *AlpacaDiscovery {
 	return &AlpacaDiscovery{
-		log:  log,
-		port: port,
-		stop: false,
+		log:           log,
+		port:          port,
+		discoveryPort: discoveryPort,
+		replied:       make(map[string]time.Time),
 	}
 }
 
-// Handle incoming UDP packets.
+// Handle incoming UDP packets until the connection is closed.
 func (a *AlpacaDiscovery) handleDiscovery(conn *net.UDPConn) {
-	for {
-		if a.stop {
-			break
-		}
+	defer a.wg.Done()
 
-		buf := make([]byte, 16)
+	response := []byte(fmt.Sprintf("{\"AlpacaPort\":%d}", a.port))
 
-		conn.SetReadDeadline((time.Now().Add(time.Second * 5)))
+	// Larger than the probe, so that longer packets are not cut down to one.
+	buf := make([]byte, 64)
 
+	for {
 		n, addr, err := conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
 		if err != nil {
-			if err.(net.Error).Timeout() {
-				continue
-			}
-
 			a.log.Error("Error reading UDP packet", zap.Error(err))
 			continue
 		}
 
-		a.log.Info("Received UDP packet", zap.String("packet", string(buf[0:n])))
+		a.log.Debug("Received UDP packet", zap.String("packet", string(buf[:n])), zap.Stringer("addr", addr))
+
+		if string(buf[:n]) != DiscoveryProbe || a.duplicate(addr) {
+			continue
+		}
 
-		if string(buf) == "alpacadiscovery1" {
-			conn.WriteToUDP([]byte(fmt.Sprintf("{\"AlpacaPort\":%d}", a.port)), addr)
+		_, err = conn.WriteToUDP(response, addr)
+		if err != nil {
+			a.log.Warn("Error replying to discovery probe", zap.Stringer("addr", addr), zap.Error(err))
 		}
 	}
 }
 
-// Start a background listener for Alpaca Discovery UDP packet.
+// duplicate reports whether the client was answered moments ago, and records
+// the reply otherwise.
+func (a *AlpacaDiscovery) duplicate(addr *net.UDPAddr) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+
+	for k, t := range a.replied {
+		if now.Sub(t) > duplicateWindow {
+			delete(a.replied, k)
+		}
+	}
+
+	key := addr.String()
+	if _, ok := a.replied[key]; ok {
+		return true
+	}
+
+	a.replied[key] = now
+
+	return false
+}
+
+// Start background listeners for Alpaca Discovery UDP packets: one for IPv4
+// broadcasts and one per multicast capable interface for the IPv6 group. An
+// interface that cannot join the group is skipped with a warning; failing to
+// listen on IPv4 is an error.
 func (a *AlpacaDiscovery) StartDiscovery() error {
-	addr, err := net.ResolveUDPAddr("udp", ":32227")
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: a.discoveryPort})
 	if err != nil {
-		return err
+		return fmt.Errorf("listening for IPv4 discovery: %w", err)
 	}
 
-	conn, err := net.ListenUDP("udp", addr)
+	a.listen(conn)
+
+	ifaces, err := net.Interfaces()
 	if err != nil {
-		return err
+		a.log.Warn("Unable to list interfaces, IPv6 discovery disabled", zap.Error(err))
+		return nil
 	}
 
-	go a.handleDiscovery(conn)
+	group := &net.UDPAddr{IP: DiscoveryGroup, Port: a.discoveryPort}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+
+		iface := iface
+
+		conn, err := net.ListenMulticastUDP("udp6", &iface, group)
+		if err != nil {
+			a.log.Warn("Unable to listen for IPv6 discovery", zap.String("interface", iface.Name), zap.Error(err))
+			continue
+		}
+
+		a.log.Debug("Listening for IPv6 discovery", zap.String("interface", iface.Name))
+
+		a.listen(conn)
+	}
 
 	return nil
 }
 
+func (a *AlpacaDiscovery) listen(conn *net.UDPConn) {
+	a.mu.Lock()
+	a.conns = append(a.conns, conn)
+	a.mu.Unlock()
+
+	a.wg.Add(1)
+	go a.handleDiscovery(conn)
+}
+
+// StopDiscovery closes the listeners and waits for them to finish.
 func (a *AlpacaDiscovery) StopDiscovery() {
-	a.stop = true
+	a.mu.Lock()
+	conns := a.conns
+	a.conns = nil
+	a.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	a.wg.Wait()
 }
@@ -0,0 +1,138 @@
+package alpaca
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ParamError is returned when a request parameter is missing or malformed.
+// Alpaca devices answer these with HTTP 400 and the message as a plain text
+// body.
+type ParamError struct {
+	Message string
+}
+
+func (e *ParamError) Error() string {
+	return e.Message
+}
+
+func missingParam(name string) error {
+	return &ParamError{Message: fmt.Sprintf("Missing parameter %s", name)}
+}
+
+func invalidParam(name, value string) error {
+	return &ParamError{Message: fmt.Sprintf("Invalid value '%s' for parameter %s", value, name)}
+}
+
+// Params holds the parameters of a request. Names are matched
+// case-insensitively for GET requests, which take them from the query string,
+// and case-sensitively for PUT requests, which take them from the form body.
+type Params struct {
+	values        url.Values
+	caseSensitive bool
+}
+
+// NewParams returns the parameters of a request made with the given method.
+func NewParams(method string, values url.Values) Params {
+	return Params{
+		values:        values,
+		caseSensitive: method != "GET",
+	}
+}
+
+// Lookup returns the first value of the named parameter and whether it was
+// present.
+func (p Params) Lookup(name string) (string, bool) {
+	if p.caseSensitive {
+		vs, ok := p.values[name]
+		if !ok || len(vs) == 0 {
+			return "", false
+		}
+
+		return vs[0], true
+	}
+
+	for k, vs := range p.values {
+		if strings.EqualFold(k, name) && len(vs) > 0 {
+			return vs[0], true
+		}
+	}
+
+	return "", false
+}
+
+// String returns the value of a required parameter. It may be empty.
+func (p Params) String(name string) (string, error) {
+	v, ok := p.Lookup(name)
+	if !ok {
+		return "", missingParam(name)
+	}
+
+	return v, nil
+}
+
+// Bool returns the value of a required boolean parameter, which must be true
+// or false in any case.
+func (p Params) Bool(name string) (bool, error) {
+	v, err := p.String(name)
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(v) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+
+	return false, invalidParam(name, v)
+}
+
+// Int returns the value of a required integer parameter.
+func (p Params) Int(name string) (int, error) {
+	v, err := p.String(name)
+	if err != nil {
+		return 0, err
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, invalidParam(name, v)
+	}
+
+	return i, nil
+}
+
+// Float returns the value of a required floating point parameter.
+func (p Params) Float(name string) (float64, error) {
+	v, err := p.String(name)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, invalidParam(name, v)
+	}
+
+	return f, nil
+}
+
+// Uint32 returns the value of an optional unsigned 32 bit parameter, or 0
+// when it is not present.
+func (p Params) Uint32(name string) (uint32, error) {
+	v, ok := p.Lookup(name)
+	if !ok {
+		return 0, nil
+	}
+
+	i, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 0, invalidParam(name, v)
+	}
+
+	return uint32(i), nil
+}
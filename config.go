@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/env"
+	"github.com/darkdragonsastro/weewx-json-alpaca/fwhm"
+	"github.com/darkdragonsastro/weewx-json-alpaca/safety"
+	"github.com/darkdragonsastro/weewx-json-alpaca/switches"
+	"github.com/darkdragonsastro/weewx-json-alpaca/weewx"
+)
+
+// loadConfig reads the configuration from the file, when there is one, and
+// the environment, and checks it.
+func loadConfig(path string) (config, error) {
+	var c config
+
+	err := env.LoadFile(&c, path)
+	if err != nil {
+		return c, err
+	}
+
+	return c, validateConfig(c)
+}
+
+// validateConfig reports the first problem with the configuration that would
+// stop the server from starting.
+func validateConfig(c config) error {
+	if c.ListenPort < 1 || c.ListenPort > 65535 {
+		return fmt.Errorf("listen port %d must be between 1 and 65535", c.ListenPort)
+	}
+
+	if c.DiscoveryPort < 0 || c.DiscoveryPort > 65535 {
+		return fmt.Errorf("discovery port %d must be between 0 and 65535", c.DiscoveryPort)
+	}
+
+	// These drive tickers, which need a positive interval.
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"config_watch_interval", c.ConfigWatchInterval},
+		{"remote_interval", c.RemoteInterval},
+		{"fwhm_watch_interval", c.FWHMWatchInterval},
+		{"allsky_interval", c.AllSkyInterval},
+	} {
+		if d.value <= 0 {
+			return fmt.Errorf("%s %s must be positive", d.name, d.value)
+		}
+	}
+
+	_, err := switches.Parse(c.SwitchConditions, c.SwitchAnalog)
+	if err != nil {
+		return fmt.Errorf("switches: %w", err)
+	}
+
+	if c.FWHMAPIKey != "" || c.FWHMWatchDir != "" {
+		_, err = fwhm.ParseMode(c.FWHMMode)
+		if err != nil {
+			return fmt.Errorf("fwhm: %w", err)
+		}
+	}
+
+	if c.RemoteURL != "" {
+		err = validRemoteMode(c.RemoteMode)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = safetyRules(c).Validate()
+	if err != nil {
+		return fmt.Errorf("safety: %w", err)
+	}
+
+	for i := 0; i <= len(c.ExtraDevices.Devices); i++ {
+		err = deviceSettings(c, i, weewx.Settings{Interval: weewx.DefaultInterval}).Validate()
+		if err != nil {
+			return fmt.Errorf("device %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// cloudModel returns the configured cloud model.
+func cloudModel(c config) weewx.CloudModel {
+	return weewx.CloudModel{
+		K1:                c.CloudK1,
+		K2:                c.CloudK2,
+		K3:                c.CloudK3,
+		K4:                c.CloudK4,
+		K5:                c.CloudK5,
+		K6:                c.CloudK6,
+		K7:                c.CloudK7,
+		ClearThreshold:    c.CloudClearThreshold,
+		OvercastThreshold: c.CloudOvercastThreshold,
+	}
+}
+
+// calibration returns the configured calibration of the first device.
+func calibration(c config) weewx.Calibration {
+	return weewx.Calibration{
+		Temperature:    c.CalibrationTemperature,
+		Humidity:       c.CalibrationHumidity,
+		Pressure:       c.CalibrationPressure,
+		SkyTemperature: c.CalibrationSkyTemperature,
+		SkyQuality:     c.CalibrationSkyQuality,
+	}
+}
+
+// safetyRules returns the configured safety rules.
+func safetyRules(c config) safety.Rules {
+	return safety.Rules{
+		WindSpeed:         safety.Limit{Max: c.SafetyMaxWindSpeed, Hysteresis: c.SafetyWindSpeedHysteresis},
+		WindGust:          safety.Limit{Max: c.SafetyMaxWindGust, Hysteresis: c.SafetyWindGustHysteresis},
+		Humidity:          safety.Limit{Max: c.SafetyMaxHumidity, Hysteresis: c.SafetyHumidityHysteresis},
+		CloudCover:        safety.Limit{Max: c.SafetyMaxCloudCover, Hysteresis: c.SafetyCloudCoverHysteresis},
+		UnsafeWhenRaining: c.SafetyUnsafeWhenRaining,
+		MaxAge:            c.SafetyMaxAge,
+		MinSafeTime:       c.SafetyMinSafeTime,
+		MinUnsafeTime:     c.SafetyMinUnsafeTime,
+	}
+}
+
+// deviceSettings returns the configured settings of the WeeWX device i, the
+// first device or else an extra device, on top of s for what is not
+// configured. The calibration is only configured for the first device.
+func deviceSettings(c config, i int, s weewx.Settings) weewx.Settings {
+	s.URL = c.WeeWxURL
+	s.AlwaysDeriveDewPoint = c.AlwaysDeriveDewPoint
+	s.SkyTemperatureField = c.SkyTemperatureField
+	s.SkyQualityField = c.SkyQualityField
+	s.CloudModel = cloudModel(c)
+
+	if i == 0 {
+		s.Calibration = calibration(c)
+		return s
+	}
+
+	dc := c.ExtraDevices.Devices[i-1]
+
+	s.URL = dc.WeeWxURL
+	if dc.AlwaysDeriveDewPoint != nil {
+		s.AlwaysDeriveDewPoint = *dc.AlwaysDeriveDewPoint
+	}
+	if dc.SkyTemperatureField != nil {
+		s.SkyTemperatureField = *dc.SkyTemperatureField
+	}
+	if dc.SkyQualityField != nil {
+		s.SkyQualityField = *dc.SkyQualityField
+	}
+
+	return s
+}
+
+// runValidateConfig checks a configuration file, together with the
+// environment variables that would override it, without starting the server.
+func runValidateConfig(args []string) error {
+	fs := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: validate-config [file]")
+		fmt.Fprintln(fs.Output(), "The file defaults to $CONFIG_FILE.")
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	path := fs.Arg(0)
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		return errors.New("no configuration file given")
+	}
+
+	_, err = loadConfig(path)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	fmt.Printf("%s: configuration is valid\n", path)
+
+	return nil
+}
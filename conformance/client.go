@@ -0,0 +1,193 @@
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// response is a decoded Alpaca response.
+type response struct {
+	Status int
+	Body   string
+
+	ClientTransactionID uint64
+	ServerTransactionID uint64
+	ErrorNumber         int
+	ErrorMessage        string
+	Value               json.RawMessage
+}
+
+// errorNumber returns an error unless the response is a 200 with the given
+// Alpaca error number.
+func (r *response) errorNumber(number int) error {
+	if r.Status != http.StatusOK {
+		return fmt.Errorf("expected status 200 with error 0x%X, got %d: %s", number, r.Status, r.Body)
+	}
+
+	if r.ErrorNumber != number {
+		return fmt.Errorf("expected error 0x%X, got 0x%X: %s", number, r.ErrorNumber, r.ErrorMessage)
+	}
+
+	return nil
+}
+
+// ok returns an error unless the response is a 200 without an Alpaca error.
+func (r *response) ok() error {
+	if r.Status != http.StatusOK {
+		return fmt.Errorf("expected status 200, got %d: %s", r.Status, r.Body)
+	}
+
+	if r.ErrorNumber != 0 {
+		return fmt.Errorf("unexpected error 0x%X: %s", r.ErrorNumber, r.ErrorMessage)
+	}
+
+	return nil
+}
+
+// badRequest returns an error unless the response is a 400 with a plain text
+// body explaining why.
+func (r *response) badRequest() error {
+	if r.Status != http.StatusBadRequest {
+		return fmt.Errorf("expected status 400, got %d: %s", r.Status, r.Body)
+	}
+
+	if strings.TrimSpace(r.Body) == "" {
+		return fmt.Errorf("400 response has no message")
+	}
+
+	return nil
+}
+
+// value decodes the Value of a successful response.
+func (r *response) value(v interface{}) error {
+	err := r.ok()
+	if err != nil {
+		return err
+	}
+
+	if r.Value == nil {
+		return fmt.Errorf("response has no Value")
+	}
+
+	err = json.Unmarshal(r.Value, v)
+	if err != nil {
+		return fmt.Errorf("decoding Value %s: %w", r.Value, err)
+	}
+
+	return nil
+}
+
+// client makes requests to one device of an Alpaca server.
+type client struct {
+	http     *http.Client
+	baseURL  string
+	device   string
+	clientID uint32
+
+	transactionID uint32
+}
+
+func (c *client) nextTransactionID() string {
+	c.transactionID++
+	return strconv.FormatUint(uint64(c.transactionID), 10)
+}
+
+// params returns the standard parameters along with the given name and value
+// pairs.
+func (c *client) params(pairs ...string) url.Values {
+	values := url.Values{}
+	values.Set("ClientID", strconv.FormatUint(uint64(c.clientID), 10))
+	values.Set("ClientTransactionID", c.nextTransactionID())
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		values.Set(pairs[i], pairs[i+1])
+	}
+
+	return values
+}
+
+// get requests the path, which is relative to the device unless it starts
+// with a slash.
+func (c *client) get(path string, values url.Values) (*response, error) {
+	u := c.url(path)
+	if len(values) > 0 {
+		u += "?" + values.Encode()
+	}
+
+	resp, err := c.http.Get(u)
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(resp)
+}
+
+// put requests the path with the values as a form body. The path is
+// relative to the device unless it starts with a slash.
+func (c *client) put(path string, values url.Values) (*response, error) {
+	req, err := http.NewRequest(http.MethodPut, c.url(path), strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(resp)
+}
+
+func (c *client) url(path string) string {
+	if strings.HasPrefix(path, "/") {
+		return c.baseURL + path
+	}
+
+	return c.baseURL + c.device + "/" + path
+}
+
+func decode(resp *http.Response) (*response, error) {
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &response{
+		Status: resp.StatusCode,
+		Body:   string(b),
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return r, nil
+	}
+
+	var body struct {
+		ClientTransactionID uint64
+		ServerTransactionID uint64
+		ErrorNumber         int
+		ErrorMessage        string
+		Value               json.RawMessage
+	}
+
+	err = json.Unmarshal(b, &body)
+	if err != nil {
+		return nil, fmt.Errorf("decoding response %q: %w", b, err)
+	}
+
+	r.ClientTransactionID = body.ClientTransactionID
+	r.ServerTransactionID = body.ServerTransactionID
+	r.ErrorNumber = body.ErrorNumber
+	r.ErrorMessage = body.ErrorMessage
+	r.Value = body.Value
+
+	return r, nil
+}
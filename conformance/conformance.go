@@ -0,0 +1,765 @@
+// Package conformance checks that an Alpaca server behaves the way ConformU
+// expects of an ObservingConditions device and of the management API.
+package conformance
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options controls a conformance run.
+type Options struct {
+	// BaseURL is the address of the server, such as http://localhost:8080.
+	BaseURL string
+	// DeviceNumber is the ObservingConditions device to check.
+	DeviceNumber int
+	// ClientID identifies the checks to the server.
+	ClientID uint32
+	// HTTPClient makes the requests. http.DefaultClient is used when nil.
+	HTTPClient *http.Client
+}
+
+// Result is the outcome of one check. Err is nil when the check passed.
+type Result struct {
+	Name string
+	Err  error
+}
+
+// sensor is an ObservingConditions sensor and the range its value must be in.
+type sensor struct {
+	Name     string
+	Property string
+	Min, Max float64
+}
+
+var sensors = []sensor{
+	{Name: "cloudcover", Property: "CloudCover", Min: 0, Max: 100},
+	{Name: "dewpoint", Property: "DewPoint", Min: -273.15, Max: 100},
+	{Name: "humidity", Property: "Humidity", Min: 0, Max: 100},
+	{Name: "pressure", Property: "Pressure", Min: 0, Max: 1100},
+	{Name: "rainrate", Property: "RainRate", Min: 0, Max: 20000},
+	{Name: "skybrightness", Property: "SkyBrightness", Min: 0, Max: 1000000},
+	{Name: "skyquality", Property: "SkyQuality", Min: -20, Max: 30},
+	{Name: "skytemperature", Property: "SkyTemperature", Min: -273.15, Max: 100},
+	{Name: "starfwhm", Property: "StarFWHM", Min: 0, Max: 1000},
+	{Name: "temperature", Property: "Temperature", Min: -273.15, Max: 100},
+	{Name: "winddirection", Property: "WindDirection", Min: 0, Max: 360},
+	{Name: "windgust", Property: "WindGust", Min: 0, Max: 1000},
+	{Name: "windspeed", Property: "WindSpeed", Min: 0, Max: 1000},
+}
+
+// suite runs the checks against one device, remembering what it has learned
+// about the device along the way.
+type suite struct {
+	c       *client
+	results []Result
+
+	// implemented holds the sensors that returned a value.
+	implemented map[string]bool
+}
+
+// Run performs every check against the device and returns the results in the
+// order they were run.
+func Run(opts Options) []Result {
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	clientID := opts.ClientID
+	if clientID == 0 {
+		clientID = 4242
+	}
+
+	s := &suite{
+		c: &client{
+			http:     httpClient,
+			baseURL:  strings.TrimRight(opts.BaseURL, "/"),
+			device:   fmt.Sprintf("/api/v1/observingconditions/%d", opts.DeviceNumber),
+			clientID: clientID,
+		},
+		implemented: make(map[string]bool),
+	}
+
+	s.management(opts.DeviceNumber)
+	s.protocol()
+	s.common()
+	s.observingConditions()
+
+	return s.results
+}
+
+// Failed returns how many of the results are failures.
+func Failed(results []Result) int {
+	n := 0
+	for _, r := range results {
+		if r.Err != nil {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (s *suite) check(name string, fn func() error) {
+	s.results = append(s.results, Result{Name: name, Err: fn()})
+}
+
+func (s *suite) management(deviceNumber int) {
+	s.check("management apiversions lists version 1", func() error {
+		resp, err := s.c.get("/management/apiversions", s.c.params())
+		if err != nil {
+			return err
+		}
+
+		var versions []int
+		err = resp.value(&versions)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range versions {
+			if v == 1 {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("versions %v do not include 1", versions)
+	})
+
+	s.check("management description has a server name", func() error {
+		resp, err := s.c.get("/management/v1/description", s.c.params())
+		if err != nil {
+			return err
+		}
+
+		var description struct {
+			ServerName          string
+			Manufacturer        string
+			ManufacturerVersion string
+			Location            string
+		}
+		err = resp.value(&description)
+		if err != nil {
+			return err
+		}
+
+		if description.ServerName == "" {
+			return errors.New("ServerName is empty")
+		}
+
+		return nil
+	})
+
+	s.check("management configureddevices lists the device", func() error {
+		resp, err := s.c.get("/management/v1/configureddevices", s.c.params())
+		if err != nil {
+			return err
+		}
+
+		var devices []struct {
+			DeviceName   string
+			DeviceType   string
+			DeviceNumber int
+			UniqueID     string
+		}
+		err = resp.value(&devices)
+		if err != nil {
+			return err
+		}
+
+		seen := make(map[string]bool)
+		found := false
+
+		for _, d := range devices {
+			if d.UniqueID == "" {
+				return fmt.Errorf("%s %d has no UniqueID", d.DeviceType, d.DeviceNumber)
+			}
+
+			if seen[d.UniqueID] {
+				return fmt.Errorf("UniqueID %s is used by more than one device", d.UniqueID)
+			}
+			seen[d.UniqueID] = true
+
+			if strings.EqualFold(d.DeviceType, "observingconditions") && d.DeviceNumber == deviceNumber {
+				found = true
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("observingconditions %d is not listed", deviceNumber)
+		}
+
+		return nil
+	})
+}
+
+func (s *suite) protocol() {
+	s.check("ClientTransactionID is echoed and ServerTransactionID set", func() error {
+		values := s.c.params()
+
+		resp, err := s.c.get("name", values)
+		if err != nil {
+			return err
+		}
+
+		err = resp.ok()
+		if err != nil {
+			return err
+		}
+
+		if strconv.FormatUint(resp.ClientTransactionID, 10) != values.Get("ClientTransactionID") {
+			return fmt.Errorf("sent ClientTransactionID %s, got %d", values.Get("ClientTransactionID"), resp.ClientTransactionID)
+		}
+
+		if resp.ServerTransactionID == 0 {
+			return errors.New("ServerTransactionID is 0")
+		}
+
+		return nil
+	})
+
+	s.check("ServerTransactionID increases", func() error {
+		first, err := s.c.get("name", s.c.params())
+		if err != nil {
+			return err
+		}
+
+		second, err := s.c.get("name", s.c.params())
+		if err != nil {
+			return err
+		}
+
+		if second.ServerTransactionID <= first.ServerTransactionID {
+			return fmt.Errorf("got %d after %d", second.ServerTransactionID, first.ServerTransactionID)
+		}
+
+		return nil
+	})
+
+	s.check("GET parameter names are case-insensitive", func() error {
+		resp, err := s.c.get("name?clientid=7&clienttransactionid=77", nil)
+		if err != nil {
+			return err
+		}
+
+		err = resp.ok()
+		if err != nil {
+			return err
+		}
+
+		if resp.ClientTransactionID != 77 {
+			return fmt.Errorf("sent clienttransactionid 77, got %d", resp.ClientTransactionID)
+		}
+
+		return nil
+	})
+
+	s.check("PUT parameter names are case-sensitive", func() error {
+		resp, err := s.c.put("connected", s.c.params("connected", "true"))
+		if err != nil {
+			return err
+		}
+
+		err = resp.badRequest()
+		if err != nil {
+			return fmt.Errorf("lower case connected was accepted: %w", err)
+		}
+
+		values := s.c.params("Connected", "true")
+		values.Del("ClientTransactionID")
+		values.Set("clienttransactionid", "78")
+
+		resp, err = s.c.put("connected", values)
+		if err != nil {
+			return err
+		}
+
+		err = resp.ok()
+		if err != nil {
+			return err
+		}
+
+		if resp.ClientTransactionID != 0 {
+			return fmt.Errorf("lower case clienttransactionid was echoed as %d", resp.ClientTransactionID)
+		}
+
+		return nil
+	})
+
+	s.check("malformed ClientID is rejected", func() error {
+		values := s.c.params()
+		values.Set("ClientID", "abc")
+
+		resp, err := s.c.get("name", values)
+		if err != nil {
+			return err
+		}
+
+		return resp.badRequest()
+	})
+
+	s.check("malformed ClientTransactionID is rejected", func() error {
+		values := s.c.params()
+		values.Set("ClientTransactionID", "-1")
+
+		resp, err := s.c.get("name", values)
+		if err != nil {
+			return err
+		}
+
+		return resp.badRequest()
+	})
+
+	s.check("unknown device number is rejected", func() error {
+		resp, err := s.c.get("/api/v1/observingconditions/9999/name", s.c.params())
+		if err != nil {
+			return err
+		}
+
+		return resp.badRequest()
+	})
+}
+
+func (s *suite) common() {
+	s.check("Connected can be set", func() error {
+		resp, err := s.c.put("connected", s.c.params("Connected", "true"))
+		if err != nil {
+			return err
+		}
+
+		err = resp.ok()
+		if err != nil {
+			return err
+		}
+
+		return s.expectConnected(true)
+	})
+
+	s.check("Connected rejects bad values", func() error {
+		resp, err := s.c.put("connected", s.c.params("Connected", "maybe"))
+		if err != nil {
+			return err
+		}
+
+		err = resp.badRequest()
+		if err != nil {
+			return err
+		}
+
+		resp, err = s.c.put("connected", s.c.params())
+		if err != nil {
+			return err
+		}
+
+		return resp.badRequest()
+	})
+
+	s.check("InterfaceVersion is 2", func() error {
+		resp, err := s.c.get("interfaceversion", s.c.params())
+		if err != nil {
+			return err
+		}
+
+		var version int
+		err = resp.value(&version)
+		if err != nil {
+			return err
+		}
+
+		if version != 2 {
+			return fmt.Errorf("got %d", version)
+		}
+
+		return nil
+	})
+
+	s.check("Connect completes and Connecting clears", func() error {
+		resp, err := s.c.put("connect", s.c.params())
+		if err != nil {
+			return err
+		}
+
+		err = resp.ok()
+		if err != nil {
+			return err
+		}
+
+		deadline := time.Now().Add(15 * time.Second)
+		for {
+			resp, err = s.c.get("connecting", s.c.params())
+			if err != nil {
+				return err
+			}
+
+			var connecting bool
+			err = resp.value(&connecting)
+			if err != nil {
+				return err
+			}
+
+			if !connecting {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				return errors.New("still connecting after 15s")
+			}
+
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		return s.expectConnected(true)
+	})
+
+	for _, name := range []string{"name", "description", "driverinfo", "driverversion"} {
+		name := name
+
+		s.check(name+" is a non-empty string", func() error {
+			resp, err := s.c.get(name, s.c.params())
+			if err != nil {
+				return err
+			}
+
+			var value string
+			err = resp.value(&value)
+			if err != nil {
+				return err
+			}
+
+			if value == "" {
+				return errors.New("empty")
+			}
+
+			return nil
+		})
+	}
+
+	s.check("SupportedActions is a list", func() error {
+		resp, err := s.c.get("supportedactions", s.c.params())
+		if err != nil {
+			return err
+		}
+
+		var actions []string
+		return resp.value(&actions)
+	})
+
+	s.check("unknown Action returns ActionNotImplemented", func() error {
+		resp, err := s.c.put("action", s.c.params("Action", "ConformanceUnknownAction", "Parameters", ""))
+		if err != nil {
+			return err
+		}
+
+		return resp.errorNumber(0x40C)
+	})
+
+	s.check("Action without parameters is rejected", func() error {
+		resp, err := s.c.put("action", s.c.params())
+		if err != nil {
+			return err
+		}
+
+		return resp.badRequest()
+	})
+
+	for _, name := range []string{"commandblind", "commandbool", "commandstring"} {
+		name := name
+
+		s.check(name+" returns NotImplemented", func() error {
+			resp, err := s.c.put(name, s.c.params("Command", "", "Raw", "false"))
+			if err != nil {
+				return err
+			}
+
+			return resp.errorNumber(0x400)
+		})
+	}
+}
+
+func (s *suite) expectConnected(expected bool) error {
+	resp, err := s.c.get("connected", s.c.params())
+	if err != nil {
+		return err
+	}
+
+	var connected bool
+	err = resp.value(&connected)
+	if err != nil {
+		return err
+	}
+
+	if connected != expected {
+		return fmt.Errorf("Connected is %t, expected %t", connected, expected)
+	}
+
+	return nil
+}
+
+func (s *suite) observingConditions() {
+	s.check("AveragePeriod can be read", func() error {
+		resp, err := s.c.get("averageperiod", s.c.params())
+		if err != nil {
+			return err
+		}
+
+		var period float64
+		err = resp.value(&period)
+		if err != nil {
+			return err
+		}
+
+		if period < 0 {
+			return fmt.Errorf("got %g", period)
+		}
+
+		return nil
+	})
+
+	s.check("AveragePeriod accepts 0 and rejects invalid values", func() error {
+		resp, err := s.c.put("averageperiod", s.c.params("AveragePeriod", "0"))
+		if err != nil {
+			return err
+		}
+
+		err = resp.ok()
+		if err != nil {
+			return fmt.Errorf("setting 0: %w", err)
+		}
+
+		resp, err = s.c.put("averageperiod", s.c.params("AveragePeriod", "-1"))
+		if err != nil {
+			return err
+		}
+
+		err = resp.errorNumber(0x401)
+		if err != nil {
+			return fmt.Errorf("setting -1: %w", err)
+		}
+
+		resp, err = s.c.put("averageperiod", s.c.params("AveragePeriod", "abc"))
+		if err != nil {
+			return err
+		}
+
+		err = resp.badRequest()
+		if err != nil {
+			return fmt.Errorf("setting abc: %w", err)
+		}
+
+		return nil
+	})
+
+	for _, sn := range sensors {
+		sn := sn
+
+		s.check(sn.Property+" is in range or not implemented", func() error {
+			resp, err := s.c.get(sn.Name, s.c.params())
+			if err != nil {
+				return err
+			}
+
+			if resp.Status == http.StatusOK && resp.ErrorNumber == 0x400 {
+				return nil
+			}
+
+			var value float64
+			err = resp.value(&value)
+			if err != nil {
+				return err
+			}
+
+			if value < sn.Min || value > sn.Max {
+				return fmt.Errorf("%g is outside %g to %g", value, sn.Min, sn.Max)
+			}
+
+			s.implemented[sn.Name] = true
+
+			return nil
+		})
+
+		s.check(sn.Property+" SensorDescription matches", func() error {
+			resp, err := s.c.get("sensordescription", s.c.params("SensorName", sn.Property))
+			if err != nil {
+				return err
+			}
+
+			if !s.implemented[sn.Name] {
+				return resp.errorNumber(0x400)
+			}
+
+			var description string
+			err = resp.value(&description)
+			if err != nil {
+				return err
+			}
+
+			if description == "" {
+				return errors.New("empty description")
+			}
+
+			return nil
+		})
+
+		s.check(sn.Property+" TimeSinceLastUpdate matches", func() error {
+			resp, err := s.c.get("timesincelastupdate", s.c.params("SensorName", sn.Property))
+			if err != nil {
+				return err
+			}
+
+			if !s.implemented[sn.Name] {
+				return resp.errorNumber(0x400)
+			}
+
+			var age float64
+			return resp.value(&age)
+		})
+	}
+
+	s.check("SensorDescription rejects unknown sensors", func() error {
+		resp, err := s.c.get("sensordescription", s.c.params("SensorName", "Bogus"))
+		if err != nil {
+			return err
+		}
+
+		err = resp.errorNumber(0x401)
+		if err != nil {
+			return err
+		}
+
+		resp, err = s.c.get("sensordescription", s.c.params())
+		if err != nil {
+			return err
+		}
+
+		return resp.badRequest()
+	})
+
+	s.check("TimeSinceLastUpdate accepts an empty sensor name", func() error {
+		resp, err := s.c.get("timesincelastupdate", s.c.params("SensorName", ""))
+		if err != nil {
+			return err
+		}
+
+		var age float64
+		return resp.value(&age)
+	})
+
+	s.check("Refresh succeeds", func() error {
+		resp, err := s.c.put("refresh", s.c.params())
+		if err != nil {
+			return err
+		}
+
+		return resp.ok()
+	})
+
+	s.check("DeviceState lists the implemented sensors and TimeStamp", s.deviceState)
+
+	s.check("sensors return NotConnected after the client disconnects", func() error {
+		other := *s.c
+		other.clientID = s.c.clientID + 1
+
+		resp, err := other.put("connected", other.params("Connected", "false"))
+		if err != nil {
+			return err
+		}
+
+		err = resp.ok()
+		if err != nil {
+			return err
+		}
+
+		resp, err = other.get("connected", other.params())
+		if err != nil {
+			return err
+		}
+
+		var connected bool
+		err = resp.value(&connected)
+		if err != nil {
+			return err
+		}
+
+		if connected {
+			return errors.New("Connected is still true")
+		}
+
+		for _, sn := range sensors {
+			if !s.implemented[sn.Name] || sn.Name == "starfwhm" {
+				continue
+			}
+
+			resp, err = other.get(sn.Name, other.params())
+			if err != nil {
+				return err
+			}
+
+			err = resp.errorNumber(0x407)
+			if err != nil {
+				return fmt.Errorf("%s: %w", sn.Property, err)
+			}
+		}
+
+		// The other client disconnecting must not affect this one.
+		return s.expectConnected(true)
+	})
+}
+
+func (s *suite) deviceState() error {
+	resp, err := s.c.get("devicestate", s.c.params())
+	if err != nil {
+		return err
+	}
+
+	var state []struct {
+		Name  string
+		Value interface{}
+	}
+	err = resp.value(&state)
+	if err != nil {
+		return err
+	}
+
+	known := map[string]bool{"TimeStamp": true}
+	for _, sn := range sensors {
+		known[sn.Property] = true
+	}
+
+	listed := make(map[string]bool)
+	for _, v := range state {
+		if !known[v.Name] {
+			return fmt.Errorf("unknown property %s", v.Name)
+		}
+
+		listed[v.Name] = true
+
+		if v.Name == "TimeStamp" {
+			ts, ok := v.Value.(string)
+			if !ok {
+				return fmt.Errorf("TimeStamp %v is not a string", v.Value)
+			}
+
+			_, err = time.Parse(time.RFC3339Nano, ts)
+			if err != nil {
+				return fmt.Errorf("TimeStamp: %w", err)
+			}
+		}
+	}
+
+	if !listed["TimeStamp"] {
+		return errors.New("TimeStamp is missing")
+	}
+
+	for _, sn := range sensors {
+		if s.implemented[sn.Name] && !listed[sn.Property] {
+			return fmt.Errorf("%s is missing", sn.Property)
+		}
+	}
+
+	return nil
+}
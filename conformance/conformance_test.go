@@ -0,0 +1,26 @@
+package conformance
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFakeServer(t *testing.T) {
+	srv := httptest.NewServer(NewFakeServer())
+	defer srv.Close()
+
+	results := Run(Options{
+		BaseURL:      srv.URL,
+		DeviceNumber: 0,
+	})
+
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("%s: %v", r.Name, r.Err)
+		}
+	}
+
+	if n := Failed(results); n > 0 {
+		t.Fatalf("%d of %d conformance checks failed", n, len(results))
+	}
+}
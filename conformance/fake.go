@@ -0,0 +1,122 @@
+package conformance
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/handler"
+	"github.com/darkdragonsastro/weewx-json-alpaca/router"
+	"github.com/darkdragonsastro/weewx-json-alpaca/safety"
+	"github.com/darkdragonsastro/weewx-json-alpaca/weewx"
+)
+
+// FakeSource is a source with fixed conditions for every sensor. Connecting
+// takes a moment, so that clients have to wait for Connecting to clear.
+type FakeSource struct {
+	mu         sync.Mutex
+	connected  bool
+	connecting atomic.Bool
+}
+
+// NewFakeSource returns a connected fake source.
+func NewFakeSource() *FakeSource {
+	return &FakeSource{
+		connected: true,
+	}
+}
+
+func (f *FakeSource) GetCurrent() *weewx.ObservingConditions {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.connected {
+		return &weewx.ObservingConditions{}
+	}
+
+	value := func(v float64) *float64 {
+		return &v
+	}
+
+	return &weewx.ObservingConditions{
+		Connected:      true,
+		DewPoint:       value(8.4),
+		Humidity:       value(62),
+		Pressure:       value(1013.2),
+		RainRate:       value(0),
+		SkyTemperature: value(-21.5),
+		CloudCover:     value(12),
+		SkyQuality:     value(20.8),
+		SkyBrightness:  value(0.0015),
+		Temperature:    value(15.6),
+		WindDirection:  value(225),
+		WindGust:       value(14.2),
+		WindSpeed:      value(6.8),
+		LastUpdated:    time.Now().Add(-3 * time.Second),
+	}
+}
+
+// Supports reports every sensor. Star FWHM is left to the handler, which
+// does not implement it without an FWHM store.
+func (f *FakeSource) Supports(sensor string) bool {
+	return true
+}
+
+func (f *FakeSource) Start() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.connected = true
+}
+
+func (f *FakeSource) Stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.connected = false
+}
+
+func (f *FakeSource) Connect() {
+	f.connecting.Store(true)
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		f.Start()
+		f.connecting.Store(false)
+	}()
+}
+
+func (f *FakeSource) Connecting() bool {
+	return f.connecting.Load()
+}
+
+// NewFakeServer returns the full router serving a single ObservingConditions
+// device backed by a FakeSource.
+func NewFakeServer() http.Handler {
+	log := zap.NewNop()
+	source := NewFakeSource()
+
+	monitor := safety.NewMonitor(safety.Rules{}, source.GetCurrent, time.Second, log)
+
+	h := handler.New([]handler.Device{
+		{
+			Name:     "weewx-json-alpaca selftest",
+			UniqueID: "weewx-json-alpaca-selftest",
+			Source:   source,
+			Shared:   true,
+		},
+	}, nil, monitor, nil, nil, handler.Identity{
+		ServerName:            "weewx-json-alpaca selftest",
+		Manufacturer:          "darkdragons",
+		Location:              "Nowhere",
+		SafetyMonitorName:     "weewx-json-alpaca selftest safety monitor",
+		SafetyMonitorUniqueID: "weewx-json-alpaca-selftest-safetymonitor",
+		SwitchName:            "weewx-json-alpaca selftest switch",
+		SwitchUniqueID:        "weewx-json-alpaca-selftest-switch",
+	})
+
+	return router.NewRouter(h, log, "", "")
+}
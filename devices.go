@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/handler"
+	"github.com/darkdragonsastro/weewx-json-alpaca/remote"
+	"github.com/darkdragonsastro/weewx-json-alpaca/settings"
+	"github.com/darkdragonsastro/weewx-json-alpaca/sqm"
+	"github.com/darkdragonsastro/weewx-json-alpaca/weewx"
+)
+
+// deviceConfig configures an additional ObservingConditions device. Unset
+// settings are taken from the first device, and the unique ID is derived from
+// the server ID and the device's place in the list.
+type deviceConfig struct {
+	Name                 string  `json:"name"`
+	UniqueID             string  `json:"unique_id"`
+	WeeWxURL             string  `json:"weewx_url"`
+	AlwaysDeriveDewPoint *bool   `json:"always_derive_dewpoint"`
+	SkyTemperatureField  *string `json:"sky_temperature_field"`
+	SkyQualityField      *string `json:"sky_quality_field"`
+	SQMAddress           *string `json:"sqm_address"`
+}
+
+// deviceConfigs is a JSON array of deviceConfig, read from an environment
+// variable.
+type deviceConfigs struct {
+	Devices []deviceConfig
+}
+
+func (d *deviceConfigs) UnmarshalText(b []byte) error {
+	err := json.Unmarshal(b, &d.Devices)
+	if err != nil {
+		return fmt.Errorf("invalid device configuration: %w", err)
+	}
+
+	for i, dc := range d.Devices {
+		if dc.WeeWxURL == "" {
+			return fmt.Errorf("device %d has no weewx_url", i+1)
+		}
+	}
+
+	return nil
+}
+
+// newDevices creates the ObservingConditions devices and the sources that
+// feed them, in the order to start them in. The first device is configured by
+// the top level settings and gets the all-sky camera and, unless it is served
+// as a device of its own, the remote Alpaca device; the others are configured
+// by the EXTRA_DEVICES list. The remote and interior devices, when enabled,
+// come last.
+func newDevices(c config, id uuid.UUID, opts weewx.Options, log *zap.Logger) ([]handler.Device, []handler.Source) {
+	client := weewx.NewClient(c.WeeWxURL, opts, log)
+
+	sources := []handler.Source{client}
+	devices := []handler.Device{
+		{
+			Name:     c.DeviceName,
+			UniqueID: deviceID(id, "observingconditions"),
+			Source:   client,
+			// The safety monitor and the switches read the first device.
+			Shared: true,
+		},
+	}
+
+	for i, dc := range c.ExtraDevices.Devices {
+		o := opts
+		o.SkyCamera = nil
+		o.Calibration = weewx.Calibration{}
+
+		if dc.AlwaysDeriveDewPoint != nil {
+			o.AlwaysDeriveDewPoint = *dc.AlwaysDeriveDewPoint
+		}
+		if dc.SkyTemperatureField != nil {
+			o.SkyTemperatureField = *dc.SkyTemperatureField
+		}
+		if dc.SkyQualityField != nil {
+			o.SkyQualityField = *dc.SkyQualityField
+		}
+		if dc.SQMAddress != nil {
+			o.SkyQualityMeter = nil
+			if *dc.SQMAddress != "" {
+				o.SkyQualityMeter = sqm.NewClient(*dc.SQMAddress)
+			}
+		}
+
+		name := dc.Name
+		if name == "" {
+			name = fmt.Sprintf("weewx-json-alpaca %d", i+1)
+		}
+
+		uniqueID := dc.UniqueID
+		if uniqueID == "" {
+			uniqueID = deviceID(id, fmt.Sprintf("observingconditions/extra/%d", i+1))
+		}
+
+		extra := weewx.NewClient(dc.WeeWxURL, o, log.With(zap.Int("device_number", i+1)))
+
+		sources = append(sources, extra)
+		devices = append(devices, handler.Device{
+			Name:     name,
+			UniqueID: uniqueID,
+			Source:   extra,
+		})
+	}
+
+	if c.RemoteURL != "" {
+		src := remote.NewSource(c.RemoteURL, c.RemoteDeviceNumber, c.RemoteInterval, log)
+		sources = append(sources, src)
+
+		switch c.RemoteMode {
+		case remoteMerge:
+			devices[0].Source = remote.Merge(client, src)
+		case remoteReplace:
+			devices[0].Source = src
+		case remoteDevice:
+			devices = append(devices, handler.Device{
+				Name:     c.RemoteDeviceName,
+				UniqueID: deviceID(id, "observingconditions/remote"),
+				Source:   src,
+			})
+		}
+	}
+
+	if c.InteriorDevice {
+		devices = append(devices, handler.Device{
+			Name:     c.InteriorDeviceName,
+			UniqueID: deviceID(id, "observingconditions/interior"),
+			Source:   client.Interior(),
+			Shared:   true,
+		})
+	}
+
+	return devices, sources
+}
+
+// How the remote Alpaca device is served.
+const (
+	// remoteMerge fills in the values the first device lacks.
+	remoteMerge = "merge"
+	// remoteReplace serves it instead of WeeWX as the first device.
+	remoteReplace = "replace"
+	// remoteDevice serves it as a device of its own.
+	remoteDevice = "device"
+)
+
+func validRemoteMode(mode string) error {
+	switch mode {
+	case remoteMerge, remoteReplace, remoteDevice:
+		return nil
+	}
+
+	return fmt.Errorf("invalid remote mode %q, must be %s, %s or %s", mode, remoteMerge, remoteReplace, remoteDevice)
+}
+
+// deviceID derives the unique ID of a device from the server ID, so that it
+// stays the same across restarts and changes of the WeeWX URL.
+func deviceID(id uuid.UUID, device string) string {
+	return uuid.NewSHA1(id, []byte(device)).String()
+}
+
+// applySettings configures the devices with the settings saved from the setup
+// pages, which take precedence over the environment.
+func applySettings(store *settings.Store, devices []handler.Device) error {
+	for _, d := range devices {
+		c, ok := d.Source.(handler.Configurable)
+		if !ok {
+			continue
+		}
+
+		s, ok := store.Device(d.UniqueID)
+		if !ok {
+			continue
+		}
+
+		err := c.Configure(s)
+		if err != nil {
+			return fmt.Errorf("device %s: %w", d.Name, err)
+		}
+	}
+
+	return nil
+}
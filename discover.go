@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/alpaca"
+)
+
+// discoveredServer is a discovered server with what it told about itself.
+type discoveredServer struct {
+	alpaca.Server
+	URL         string                    `json:"url"`
+	Description *alpaca.Description       `json:"description,omitempty"`
+	Devices     []alpaca.ConfiguredDevice `json:"devices,omitempty"`
+	Error       string                    `json:"error,omitempty"`
+}
+
+// runDiscover finds the Alpaca servers on the network and lists their
+// devices.
+func runDiscover(args []string) error {
+	fs := flag.NewFlagSet("discover", flag.ContinueOnError)
+	port := fs.Int("port", alpaca.DefaultDiscoveryPort, "discovery port")
+	timeout := fs.Duration("timeout", 2*time.Second, "how long to wait for replies")
+	noIPv4 := fs.Bool("no-ipv4", false, "do not probe over IPv4")
+	noIPv6 := fs.Bool("no-ipv6", false, "do not probe over IPv6")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	servers, err := alpaca.Discover(ctx, alpaca.DiscoverOptions{
+		Port:        *port,
+		Timeout:     *timeout,
+		DisableIPv4: *noIPv4,
+		DisableIPv6: *noIPv6,
+	})
+	if err != nil {
+		return err
+	}
+
+	c := &http.Client{Timeout: *timeout}
+
+	found := make([]discoveredServer, len(servers))
+
+	var wg sync.WaitGroup
+	for i, s := range servers {
+		wg.Add(1)
+		go func(d *discoveredServer, s alpaca.Server) {
+			defer wg.Done()
+
+			d.Server = s
+			d.URL = s.BaseURL()
+
+			var err error
+			d.Description, err = alpaca.GetDescription(ctx, c, d.URL)
+			if err != nil {
+				d.Error = err.Error()
+				return
+			}
+
+			d.Devices, err = alpaca.GetConfiguredDevices(ctx, c, d.URL)
+			if err != nil {
+				d.Error = err.Error()
+			}
+		}(&found[i], s)
+	}
+	wg.Wait()
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(found)
+	}
+
+	if len(found) == 0 {
+		fmt.Println("no Alpaca servers found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	for _, d := range found {
+		fmt.Fprintf(w, "%s\n", d.URL)
+
+		if d.Description != nil {
+			fmt.Fprintf(w, "  %s\t%s %s\t%s\n", d.Description.ServerName, d.Description.Manufacturer, d.Description.ManufacturerVersion, d.Description.Location)
+		}
+
+		for _, dev := range d.Devices {
+			fmt.Fprintf(w, "  %s/%d\t%s\t%s\n", dev.DeviceType, dev.DeviceNumber, dev.DeviceName, dev.UniqueID)
+		}
+
+		if d.Error != "" {
+			fmt.Fprintf(w, "  error: %s\n", d.Error)
+		}
+	}
+
+	return w.Flush()
+}
@@ -1,7 +1,17 @@
 package env
 
 import (
-	"github.com/caarlos0/env"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/caarlos0/env/v11"
+	"gopkg.in/yaml.v3"
 )
 
 // Config represents the common environment variables needed for all apps.
@@ -10,5 +20,128 @@ type Config struct {
 
 // Load will bind the environment variables to the given config.
 func Load(c interface{}) error {
-	return env.Parse(c)
+	return LoadFile(c, "")
+}
+
+// LoadFile will bind the settings in the YAML file at path, and the
+// environment variables, to the given config. Environment variables take
+// precedence over the file, and defaults apply to what neither sets. The file
+// is skipped when path is empty.
+//
+// The keys of the file are the names of the environment variables in lower
+// case. Nested keys are joined with an underscore, so that
+//
+//	safety:
+//	  max_wind_speed: 40
+//
+// sets SAFETY_MAX_WIND_SPEED. Lists and objects are passed on as JSON.
+func LoadFile(c interface{}, path string) error {
+	environment := env.ToMap(os.Environ())
+
+	if path != "" {
+		values, err := ReadFile(path, c)
+		if err != nil {
+			return err
+		}
+
+		for k, v := range values {
+			if _, ok := environment[k]; !ok {
+				environment[k] = v
+			}
+		}
+	}
+
+	err := env.ParseWithOptions(c, env.Options{Environment: environment})
+	if err != nil {
+		if path != "" {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ReadFile reads the YAML file at path into environment variables, rejecting
+// keys that are not variables of the config c.
+func ReadFile(path string, c interface{}) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+
+	err = yaml.NewDecoder(bytes.NewReader(b)).Decode(&doc)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	params, err := env.GetFieldParams(c)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(params))
+	for _, p := range params {
+		known[p.Key] = true
+	}
+
+	values := make(map[string]string)
+
+	err = flatten(doc, "", known, values)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+// flatten sets values from the YAML document, joining the keys of nested
+// objects until they name a known variable.
+func flatten(doc map[string]interface{}, prefix string, known map[string]bool, values map[string]string) error {
+	keys := make([]string, 0, len(doc))
+	for k := range doc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		name := prefix + strings.ToUpper(k)
+		v := doc[k]
+
+		if !known[name] {
+			nested, ok := v.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("unknown setting %s", strings.ToLower(name))
+			}
+
+			err := flatten(nested, name+"_", known, values)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, ok := values[name]; ok {
+			return fmt.Errorf("setting %s is set twice", strings.ToLower(name))
+		}
+
+		switch v := v.(type) {
+		case nil:
+			continue
+		case string:
+			values[name] = v
+		case []interface{}, map[string]interface{}:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("setting %s: %w", strings.ToLower(name), err)
+			}
+			values[name] = string(b)
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,331 @@
+// Package fits reads and writes the primary image of FITS files.
+package fits
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	blockSize = 2880
+	cardSize  = 80
+
+	// maxAxis and maxPixels bound the images read, well above the largest
+	// astronomy sensors, so that a malformed header cannot exhaust memory.
+	maxAxis   = 1 << 16
+	maxPixels = 1 << 28
+)
+
+// Image is a single plane of a FITS image in physical units.
+type Image struct {
+	Width  int
+	Height int
+	// Pixels holds the values row by row, starting at the bottom left.
+	Pixels []float64
+	// Header holds the header cards by keyword. String values are unquoted.
+	Header map[string]string
+}
+
+// At returns the pixel value at x, y.
+func (img *Image) At(x, y int) float64 {
+	return img.Pixels[y*img.Width+x]
+}
+
+// HeaderFloat returns the header value as a float, and false if it is missing
+// or not a number.
+func (img *Image) HeaderFloat(key string) (float64, bool) {
+	v, ok := img.Header[key]
+	if !ok {
+		return 0, false
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return f, true
+}
+
+// IsFITS reports whether the file name has a FITS extension.
+func IsFITS(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".fits", ".fit", ".fts":
+		return true
+	}
+
+	return false
+}
+
+// ReadFile reads the primary image of the FITS file at path.
+func ReadFile(path string) (*Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Read(bufio.NewReader(f))
+}
+
+// Read reads the primary image of a FITS file. Only the first plane of a cube
+// is returned.
+func Read(r io.Reader) (*Image, error) {
+	header, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if header["SIMPLE"] != "T" {
+		return nil, errors.New("not a FITS file")
+	}
+
+	ints := map[string]int{}
+	for _, k := range []string{"BITPIX", "NAXIS", "NAXIS1", "NAXIS2"} {
+		v, err := strconv.Atoi(header[k])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s header %q", k, header[k])
+		}
+
+		ints[k] = v
+	}
+
+	if ints["NAXIS"] < 2 {
+		return nil, fmt.Errorf("unsupported NAXIS %d", ints["NAXIS"])
+	}
+
+	bzero, bscale := 0.0, 1.0
+	if v, ok := header["BZERO"]; ok {
+		bzero, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BZERO header %q", v)
+		}
+	}
+	if v, ok := header["BSCALE"]; ok {
+		bscale, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BSCALE header %q", v)
+		}
+	}
+
+	switch ints["BITPIX"] {
+	case 8, 16, 32, -32, -64:
+	default:
+		return nil, fmt.Errorf("unsupported BITPIX %d", ints["BITPIX"])
+	}
+
+	width, height := ints["NAXIS1"], ints["NAXIS2"]
+	if width < 1 || width > maxAxis || height < 1 || height > maxAxis {
+		return nil, fmt.Errorf("unsupported image size %dx%d", width, height)
+	}
+
+	// Divided rather than multiplied, so that it cannot overflow.
+	if width > maxPixels/height {
+		return nil, fmt.Errorf("image of %dx%d pixels is too large", width, height)
+	}
+
+	bytesPerPixel := ints["BITPIX"] / 8
+	if bytesPerPixel < 0 {
+		bytesPerPixel = -bytesPerPixel
+	}
+
+	raw := make([]byte, width*height*bytesPerPixel)
+	_, err = io.ReadFull(r, raw)
+	if err != nil {
+		return nil, fmt.Errorf("reading image data: %w", err)
+	}
+
+	pixels := make([]float64, width*height)
+	for i := range pixels {
+		b := raw[i*bytesPerPixel:]
+
+		var v float64
+		switch ints["BITPIX"] {
+		case 8:
+			v = float64(b[0])
+		case 16:
+			v = float64(int16(binary.BigEndian.Uint16(b)))
+		case 32:
+			v = float64(int32(binary.BigEndian.Uint32(b)))
+		case -32:
+			v = float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+		case -64:
+			v = math.Float64frombits(binary.BigEndian.Uint64(b))
+		}
+
+		pixels[i] = bzero + bscale*v
+	}
+
+	return &Image{
+		Width:  width,
+		Height: height,
+		Pixels: pixels,
+		Header: header,
+	}, nil
+}
+
+func readHeader(r io.Reader) (map[string]string, error) {
+	header := map[string]string{}
+	block := make([]byte, blockSize)
+
+	for {
+		_, err := io.ReadFull(r, block)
+		if err != nil {
+			return nil, fmt.Errorf("reading header: %w", err)
+		}
+
+		for i := 0; i < blockSize; i += cardSize {
+			card := string(block[i : i+cardSize])
+			key := strings.TrimSpace(card[:8])
+
+			if key == "END" {
+				return header, nil
+			}
+
+			if card[8:10] != "= " {
+				continue
+			}
+
+			header[key] = parseValue(card[10:])
+		}
+	}
+}
+
+// parseValue returns the value of a card, stripping the comment and the
+// quotes around strings.
+func parseValue(s string) string {
+	s = strings.TrimSpace(s)
+
+	if strings.HasPrefix(s, "'") {
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\'' {
+				// Two quotes are an escaped quote.
+				if i+1 < len(s) && s[i+1] == '\'' {
+					b.WriteByte('\'')
+					i++
+					continue
+				}
+				break
+			}
+			b.WriteByte(s[i])
+		}
+
+		return strings.TrimRight(b.String(), " ")
+	}
+
+	if i := strings.Index(s, "/"); i >= 0 {
+		s = s[:i]
+	}
+
+	return strings.TrimSpace(s)
+}
+
+// WriteFile writes the image as a 16-bit unsigned FITS file. Values are
+// clamped to the range 0-65535. Extra header cards are written in sorted
+// order after the required ones.
+func WriteFile(path string, img *Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+
+	err = Write(w, img)
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// Write writes the image as a 16-bit unsigned FITS file.
+func Write(w io.Writer, img *Image) error {
+	cards := []string{
+		card("SIMPLE", "T"),
+		card("BITPIX", "16"),
+		card("NAXIS", "2"),
+		card("NAXIS1", strconv.Itoa(img.Width)),
+		card("NAXIS2", strconv.Itoa(img.Height)),
+		card("BZERO", "32768"),
+		card("BSCALE", "1"),
+	}
+
+	for _, k := range sortedKeys(img.Header) {
+		switch k {
+		case "SIMPLE", "BITPIX", "NAXIS", "NAXIS1", "NAXIS2", "BZERO", "BSCALE", "END":
+			continue
+		}
+
+		v := img.Header[k]
+		if _, err := strconv.ParseFloat(v, 64); err != nil && v != "T" && v != "F" {
+			v = "'" + strings.ReplaceAll(v, "'", "''") + "'"
+		}
+
+		cards = append(cards, card(k, v))
+	}
+
+	cards = append(cards, fmt.Sprintf("%-80s", "END"))
+
+	header := strings.Join(cards, "")
+	header += strings.Repeat(" ", padding(len(header)))
+
+	_, err := io.WriteString(w, header)
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, 2*len(img.Pixels), 2*len(img.Pixels)+padding(2*len(img.Pixels)))
+	for i, v := range img.Pixels {
+		v = math.Max(0, math.Min(65535, math.Round(v)))
+		binary.BigEndian.PutUint16(data[2*i:], uint16(int(v)-32768))
+	}
+
+	data = data[:cap(data)]
+
+	_, err = w.Write(data)
+	return err
+}
+
+func card(key, value string) string {
+	format := "%-8s= %20s"
+	if strings.HasPrefix(value, "'") {
+		format = "%-8s= %-20s"
+	}
+
+	c := fmt.Sprintf(format, key, value)
+	if len(c) > cardSize {
+		return c[:cardSize]
+	}
+
+	return c + strings.Repeat(" ", cardSize-len(c))
+}
+
+func padding(n int) int {
+	return (blockSize - n%blockSize) % blockSize
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
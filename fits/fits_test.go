@@ -0,0 +1,100 @@
+package fits
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// header returns a FITS header with the given cards.
+func header(cards ...string) []byte {
+	var b strings.Builder
+	for _, c := range cards {
+		b.WriteString(fmt.Sprintf("%-80s", c))
+	}
+	b.WriteString(fmt.Sprintf("%-80s", "END"))
+	b.WriteString(strings.Repeat(" ", padding(b.Len())))
+
+	return []byte(b.String())
+}
+
+func TestReadRejectsBadSizes(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		naxis1 string
+		naxis2 string
+	}{
+		{"negative width", "-10", "10"},
+		{"negative height", "10", "-10"},
+		{"zero width", "0", "10"},
+		{"huge width", "1000000000", "1"},
+		{"too many pixels", "65536", "65536"},
+		{"overflowing", "9223372036854775807", "9223372036854775807"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := header(
+				card("SIMPLE", "T"),
+				card("BITPIX", "16"),
+				card("NAXIS", "2"),
+				card("NAXIS1", tt.naxis1),
+				card("NAXIS2", tt.naxis2),
+			)
+
+			_, err := Read(bytes.NewReader(b))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	img := &Image{
+		Width:  3,
+		Height: 2,
+		Pixels: []float64{0, 1, 2, 1000, 40000, 65535},
+		Header: map[string]string{"FILTER": "L"},
+	}
+
+	var b bytes.Buffer
+
+	err := Write(&b, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Read(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Width != img.Width || got.Height != img.Height {
+		t.Fatalf("size %dx%d, want %dx%d", got.Width, got.Height, img.Width, img.Height)
+	}
+
+	for i, v := range img.Pixels {
+		if got.Pixels[i] != v {
+			t.Errorf("pixel %d is %g, want %g", i, got.Pixels[i], v)
+		}
+	}
+
+	if got.Header["FILTER"] != "L" {
+		t.Errorf("FILTER is %q, want L", got.Header["FILTER"])
+	}
+}
+
+func TestIsFITS(t *testing.T) {
+	for name, want := range map[string]bool{
+		"frame.fits":     true,
+		"frame.FIT":      true,
+		"frame.fts":      true,
+		"frame.jpg":      false,
+		"frame.fits.tmp": false,
+		"fits":           false,
+	} {
+		if got := IsFITS(name); got != want {
+			t.Errorf("IsFITS(%q) = %t, want %t", name, got, want)
+		}
+	}
+}
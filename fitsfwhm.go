@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/fwhm"
+	"github.com/darkdragonsastro/weewx-json-alpaca/stars"
+)
+
+// runFITSFWHM measures the star FWHM of the given FITS files and prints the
+// results, one file per line.
+func runFITSFWHM(args []string) error {
+	opts := stars.DefaultOptions()
+
+	fs := flag.NewFlagSet("fits-fwhm", flag.ContinueOnError)
+	pixelScale := fs.Float64("pixel-scale", 0, "image scale in arcseconds per pixel, read from the header when zero")
+	fs.Float64Var(&opts.Threshold, "threshold", opts.Threshold, "detection threshold in standard deviations of the background")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range fs.Args() {
+		m, err := fwhm.Measure(path, *pixelScale, opts)
+		if err != nil {
+			fmt.Printf("%s\terror: %v\n", path, err)
+			continue
+		}
+
+		fmt.Printf("%s\t%.2f\"\t%s\n", path, m.FWHM, m.Source)
+	}
+
+	return nil
+}
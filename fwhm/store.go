@@ -0,0 +1,150 @@
+// Package fwhm keeps the star FWHM measurements reported by imaging
+// applications and reduces them to the value served as StarFWHM.
+package fwhm
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Mode selects how the measurements are reduced to a single value.
+type Mode string
+
+const (
+	// ModeLatest serves the most recent measurement.
+	ModeLatest Mode = "latest"
+	// ModeAverage serves the mean of the measurements within the average
+	// window.
+	ModeAverage Mode = "average"
+)
+
+// ParseMode parses the mode name, defaulting to ModeLatest when empty.
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case "", ModeLatest:
+		return ModeLatest, nil
+	case ModeAverage:
+		return ModeAverage, nil
+	}
+
+	return "", fmt.Errorf("unknown fwhm mode %q", s)
+}
+
+// maxMeasurements caps the number of measurements kept in memory.
+const maxMeasurements = 500
+
+// Measurement is a single star FWHM measurement of one frame.
+type Measurement struct {
+	// FWHM is the star full width at half maximum in arcseconds.
+	FWHM      float64   `json:"fwhm"`
+	Timestamp time.Time `json:"timestamp"`
+	Filter    string    `json:"filter,omitempty"`
+	// Exposure is the exposure time of the frame in seconds.
+	Exposure float64 `json:"exposure,omitempty"`
+	// Source names the application that measured the frame.
+	Source string `json:"source,omitempty"`
+}
+
+// Store keeps the recent measurements.
+type Store struct {
+	mode          Mode
+	averageWindow time.Duration
+	maxAge        time.Duration
+
+	mu           sync.RWMutex
+	measurements []Measurement
+}
+
+// NewStore creates a new store. Measurements older than maxAge are considered
+// stale and are not served.
+func NewStore(mode Mode, averageWindow, maxAge time.Duration) *Store {
+	return &Store{
+		mode:          mode,
+		averageWindow: averageWindow,
+		maxAge:        maxAge,
+	}
+}
+
+// Add records a new measurement.
+func (s *Store) Add(m Measurement) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Keep the measurements sorted by time, since frames can be reported out
+	// of order.
+	i := len(s.measurements)
+	for i > 0 && s.measurements[i-1].Timestamp.After(m.Timestamp) {
+		i--
+	}
+
+	s.measurements = append(s.measurements, Measurement{})
+	copy(s.measurements[i+1:], s.measurements[i:])
+	s.measurements[i] = m
+
+	if len(s.measurements) > maxMeasurements {
+		s.measurements = s.measurements[len(s.measurements)-maxMeasurements:]
+	}
+}
+
+// Current returns the value to serve as StarFWHM, or nil if there is no
+// measurement newer than the maximum age.
+func (s *Store) Current() *float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.measurements) == 0 {
+		return nil
+	}
+
+	latest := s.measurements[len(s.measurements)-1]
+	if s.maxAge > 0 && time.Since(latest.Timestamp) > s.maxAge {
+		return nil
+	}
+
+	if s.mode == ModeLatest {
+		v := latest.FWHM
+		return &v
+	}
+
+	since := latest.Timestamp.Add(-s.averageWindow)
+
+	sum := 0.0
+	n := 0
+
+	for i := len(s.measurements) - 1; i >= 0 && !s.measurements[i].Timestamp.Before(since); i-- {
+		sum += s.measurements[i].FWHM
+		n++
+	}
+
+	v := sum / float64(n)
+	return &v
+}
+
+// LastUpdated returns the time of the most recent measurement.
+func (s *Store) LastUpdated() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.measurements) == 0 {
+		return time.Time{}
+	}
+
+	return s.measurements[len(s.measurements)-1].Timestamp
+}
+
+// Measurements returns the measurements taken since the given time, oldest
+// first.
+func (s *Store) Measurements(since time.Time) []Measurement {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []Measurement
+	for _, m := range s.measurements {
+		if !m.Timestamp.Before(since) {
+			out = append(out, m)
+		}
+	}
+
+	return out
+}
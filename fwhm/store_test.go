@@ -0,0 +1,156 @@
+package fwhm
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestStoreCurrent(t *testing.T) {
+	now := time.Now()
+
+	// at returns a measurement taken the given time ago.
+	at := func(ago time.Duration, fwhm float64) Measurement {
+		return Measurement{FWHM: fwhm, Timestamp: now.Add(-ago)}
+	}
+
+	tests := []struct {
+		name         string
+		mode         Mode
+		maxAge       time.Duration
+		measurements []Measurement
+		want         *float64
+	}{
+		{
+			name: "empty",
+			mode: ModeLatest,
+		},
+		{
+			name:         "latest",
+			mode:         ModeLatest,
+			measurements: []Measurement{at(3*time.Minute, 3), at(time.Minute, 2)},
+			want:         value(2),
+		},
+		{
+			name:         "latest reported out of order",
+			mode:         ModeLatest,
+			measurements: []Measurement{at(time.Minute, 2), at(3*time.Minute, 3)},
+			want:         value(2),
+		},
+		{
+			name:         "average within the window",
+			mode:         ModeAverage,
+			measurements: []Measurement{at(20*time.Minute, 10), at(9*time.Minute, 3), at(5*time.Minute, 2), at(time.Minute, 1)},
+			want:         value(2),
+		},
+		{
+			name:         "average reported out of order",
+			mode:         ModeAverage,
+			measurements: []Measurement{at(time.Minute, 1), at(20*time.Minute, 10), at(5*time.Minute, 2), at(9*time.Minute, 3)},
+			want:         value(2),
+		},
+		{
+			name:         "average window ends at the latest measurement",
+			mode:         ModeAverage,
+			measurements: []Measurement{at(26*time.Minute, 4), at(20*time.Minute, 2), at(15*time.Minute, 10)},
+			maxAge:       time.Hour,
+			want:         value(6),
+		},
+		{
+			name:         "stale",
+			mode:         ModeLatest,
+			maxAge:       30 * time.Minute,
+			measurements: []Measurement{at(31*time.Minute, 2)},
+		},
+		{
+			name:         "stale average",
+			mode:         ModeAverage,
+			maxAge:       30 * time.Minute,
+			measurements: []Measurement{at(35*time.Minute, 2), at(31*time.Minute, 2)},
+		},
+		{
+			name:         "no maximum age",
+			mode:         ModeLatest,
+			measurements: []Measurement{at(48*time.Hour, 2)},
+			want:         value(2),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStore(tt.mode, 10*time.Minute, tt.maxAge)
+			for _, m := range tt.measurements {
+				s.Add(m)
+			}
+
+			got := s.Current()
+
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil:
+				t.Errorf("Current() = %v, want %v", deref(got), deref(tt.want))
+			case math.Abs(*got-*tt.want) > 1e-9:
+				t.Errorf("Current() = %g, want %g", *got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestStoreMeasurements(t *testing.T) {
+	now := time.Now()
+
+	s := NewStore(ModeLatest, time.Minute, time.Hour)
+	for _, ago := range []int{2, 5, 1, 4, 3} {
+		s.Add(Measurement{FWHM: float64(ago), Timestamp: now.Add(-time.Duration(ago) * time.Minute)})
+	}
+
+	got := s.Measurements(now.Add(-3 * time.Minute))
+	if len(got) != 3 || got[0].FWHM != 3 || got[1].FWHM != 2 || got[2].FWHM != 1 {
+		t.Errorf("measurements of the last 3 minutes %+v, want 3, 2 and 1, oldest first", got)
+	}
+
+	if want := now.Add(-time.Minute); !s.LastUpdated().Equal(want) {
+		t.Errorf("LastUpdated() = %s, want %s", s.LastUpdated(), want)
+	}
+}
+
+func TestStoreKeepsTheNewest(t *testing.T) {
+	now := time.Now()
+
+	s := NewStore(ModeLatest, time.Minute, 0)
+	for i := 0; i < maxMeasurements+10; i++ {
+		s.Add(Measurement{FWHM: float64(i), Timestamp: now.Add(time.Duration(i) * time.Second)})
+	}
+
+	got := s.Measurements(time.Time{})
+	if len(got) != maxMeasurements || got[0].FWHM != 10 {
+		t.Errorf("kept %d measurements starting at %g, want %d starting at 10", len(got), got[0].FWHM, maxMeasurements)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for s, want := range map[string]Mode{"": ModeLatest, "latest": ModeLatest, "average": ModeAverage} {
+		got, err := ParseMode(s)
+		if err != nil || got != want {
+			t.Errorf("ParseMode(%q) = %q, %v, want %q", s, got, err, want)
+		}
+	}
+
+	_, err := ParseMode("median")
+	if err == nil {
+		t.Error("ParseMode accepted an unknown mode")
+	}
+}
+
+func value(f float64) *float64 {
+	return &f
+}
+
+// deref returns the value for printing, or nil.
+func deref(f *float64) any {
+	if f == nil {
+		return nil
+	}
+
+	return *f
+}
@@ -0,0 +1,227 @@
+package fwhm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/fits"
+	"github.com/darkdragonsastro/weewx-json-alpaca/stars"
+)
+
+// WatcherOptions configures a Watcher.
+type WatcherOptions struct {
+	// Dir is the directory the capture software writes frames into.
+	Dir string
+	// PixelScale is the image scale in arcseconds per pixel. When zero, it is
+	// taken from the FITS header.
+	PixelScale float64
+	// Interval is how often the directory is scanned.
+	Interval time.Duration
+	// Stars controls the star detection.
+	Stars stars.Options
+}
+
+// Watcher measures the star FWHM of new FITS frames in a directory and adds
+// the results to a Store.
+type Watcher struct {
+	store *Store
+	opts  WatcherOptions
+	log   *zap.Logger
+
+	// sizes holds the size of files that were seen but not processed yet, so
+	// frames still being written are only processed once their size settles.
+	sizes map[string]int64
+	done  map[string]bool
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewWatcher creates a new watcher.
+func NewWatcher(store *Store, opts WatcherOptions, log *zap.Logger) *Watcher {
+	return &Watcher{
+		store: store,
+		opts:  opts,
+		log:   log,
+		sizes: map[string]int64{},
+		done:  map[string]bool{},
+		stop:  make(chan struct{}),
+	}
+}
+
+// Start begins watching the directory. Frames already in the directory are
+// skipped.
+func (w *Watcher) Start() error {
+	files, err := w.frames()
+	if err != nil {
+		return err
+	}
+
+	for path := range files {
+		w.done[path] = true
+	}
+
+	w.log.Info("starting fits watcher", zap.String("dir", w.opts.Dir))
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.opts.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.stop:
+				w.log.Info("stopping fits watcher")
+				return
+			case <-ticker.C:
+				w.scan()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops watching and waits for the frame being measured to finish.
+func (w *Watcher) Stop() {
+	close(w.stop)
+	w.wg.Wait()
+}
+
+func (w *Watcher) scan() {
+	files, err := w.frames()
+	if err != nil {
+		w.log.Error("error scanning fits directory", zap.Error(err))
+		return
+	}
+
+	for path, size := range files {
+		if w.done[path] {
+			continue
+		}
+
+		if last, ok := w.sizes[path]; !ok || last != size {
+			w.sizes[path] = size
+			continue
+		}
+
+		delete(w.sizes, path)
+		w.done[path] = true
+
+		m, err := Measure(path, w.opts.PixelScale, w.opts.Stars)
+		if err != nil {
+			w.log.Warn("error measuring fwhm", zap.String("path", path), zap.Error(err))
+			continue
+		}
+
+		w.log.Info("measured fwhm", zap.String("path", path), zap.Float64("fwhm", m.FWHM))
+
+		w.store.Add(*m)
+	}
+
+	// Forget files that were removed, so the maps do not grow forever.
+	for path := range w.done {
+		if _, ok := files[path]; !ok {
+			delete(w.done, path)
+		}
+	}
+}
+
+// frames returns the FITS files in the directory with their sizes.
+func (w *Watcher) frames() (map[string]int64, error) {
+	entries, err := os.ReadDir(w.opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]int64{}
+	for _, e := range entries {
+		if e.IsDir() || !fits.IsFITS(e.Name()) {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		files[filepath.Join(w.opts.Dir, e.Name())] = info.Size()
+	}
+
+	return files, nil
+}
+
+// Measure computes the median star FWHM in arcseconds of the FITS frame at
+// path. If pixelScale is zero, the scale is read from the PIXSCALE or SCALE
+// header, or computed from XPIXSZ and FOCALLEN.
+func Measure(path string, pixelScale float64, opts stars.Options) (*Measurement, error) {
+	img, err := fits.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if pixelScale == 0 {
+		pixelScale = headerPixelScale(img)
+	}
+
+	if pixelScale == 0 {
+		return nil, errors.New("no pixel scale configured or in the fits header")
+	}
+
+	fwhm, n, ok := stars.MedianFWHM(img, opts)
+	if !ok {
+		return nil, errors.New("no stars detected")
+	}
+
+	timestamp := time.Time{}
+	if v, ok := img.Header["DATE-OBS"]; ok {
+		timestamp, _ = time.Parse("2006-01-02T15:04:05.999999999", v)
+	}
+
+	if timestamp.IsZero() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		timestamp = info.ModTime()
+	}
+
+	exposure, ok := img.HeaderFloat("EXPTIME")
+	if !ok {
+		exposure, _ = img.HeaderFloat("EXPOSURE")
+	}
+
+	return &Measurement{
+		FWHM:      fwhm * pixelScale,
+		Timestamp: timestamp,
+		Filter:    img.Header["FILTER"],
+		Exposure:  exposure,
+		Source:    fmt.Sprintf("fits (%d stars)", n),
+	}, nil
+}
+
+func headerPixelScale(img *fits.Image) float64 {
+	for _, k := range []string{"PIXSCALE", "SCALE"} {
+		if v, ok := img.HeaderFloat(k); ok && v > 0 {
+			return v
+		}
+	}
+
+	pixelSize, ok1 := img.HeaderFloat("XPIXSZ")
+	focalLength, ok2 := img.HeaderFloat("FOCALLEN")
+	if ok1 && ok2 && focalLength > 0 {
+		// XPIXSZ is in microns and FOCALLEN in millimeters.
+		return 206.265 * pixelSize / focalLength
+	}
+
+	return 0
+}
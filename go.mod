@@ -3,12 +3,21 @@ module github.com/darkdragonsastro/weewx-json-alpaca
 go 1.21.2
 
 require (
-	github.com/caarlos0/env v3.5.0+incompatible // indirect
-	github.com/go-chi/chi v1.5.5 // indirect
+	github.com/caarlos0/env/v11 v11.4.0
+	github.com/go-chi/chi v1.5.5
+	github.com/google/uuid v1.3.1
+	github.com/grandcat/zeroconf v1.0.0
+	go.uber.org/zap v1.26.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/cenkalti/backoff v2.2.1+incompatible // indirect
 	github.com/go-chi/cors v1.2.1 // indirect
-	github.com/google/uuid v1.3.1 // indirect
-	github.com/gorilla/schema v1.2.0 // indirect
+	github.com/miekg/dns v1.1.27 // indirect
 	github.com/patrickmn/go-cache v2.1.0+incompatible // indirect
 	go.uber.org/multierr v1.10.0 // indirect
-	go.uber.org/zap v1.26.0 // indirect
+	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550 // indirect
+	golang.org/x/net v0.0.0-20200114155413-6afb5195e5aa // indirect
+	golang.org/x/sys v0.0.0-20190924154521-2837fb4f24fe // indirect
 )
@@ -0,0 +1,63 @@
+// Package handler implements the request handlers for the API.
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/alpaca"
+)
+
+// action is a custom Alpaca action supported by the device.
+type action struct {
+	Name string
+	// Run performs the action for the request. An AlpacaError is reported as
+	// is; any other error as a driver error.
+	Run func(r *http.Request, parameters string) (string, error)
+}
+
+// actions returns the custom actions supported by the device the request is
+// for.
+func (h *Handler) actions(r *http.Request) []action {
+	ctx := alpaca.FromContext(r.Context())
+
+	var actions []action
+
+	if ctx.DeviceType != nil {
+		switch *ctx.DeviceType {
+		case "safetymonitor":
+			actions = append(actions, action{Name: "GetUnsafeReasons", Run: h.unsafeReasonsAction})
+			return actions
+		case "switch":
+			return actions
+		}
+	}
+
+	actions = append(actions, action{Name: "GetAllConditions", Run: h.allConditionsAction})
+
+	if _, ok := h.device(r).Source.(Reporter); ok {
+		actions = append(actions,
+			action{Name: "GetStationInfo", Run: h.stationInfoAction},
+			action{Name: "GetRawSource", Run: h.rawSourceAction},
+			action{Name: "GetExtendedSensors", Run: h.extendedSensorsAction},
+		)
+	}
+
+	if h.supports(r, "starfwhm") {
+		actions = append(actions, action{Name: "GetFWHMMeasurements", Run: h.fwhmMeasurementsAction})
+	}
+
+	return actions
+}
+
+// findAction looks up the action by name. Action names are matched
+// case-insensitively.
+func (h *Handler) findAction(r *http.Request, name string) *action {
+	for _, a := range h.actions(r) {
+		if strings.EqualFold(a.Name, name) {
+			return &a
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/conformance"
+	"github.com/darkdragonsastro/weewx-json-alpaca/fwhm"
+)
+
+func TestFWHMMeasurementsActionOnlyOnFirstDevice(t *testing.T) {
+	store := fwhm.NewStore(fwhm.ModeLatest, time.Minute, time.Hour)
+	store.Add(fwhm.Measurement{FWHM: 2.4, Timestamp: time.Now()})
+
+	srv := newServer(t, store, conformance.NewFakeSource(), conformance.NewFakeSource())
+
+	for _, tt := range []struct {
+		device    string
+		supported bool
+	}{
+		{"0", true},
+		{"1", false},
+	} {
+		t.Run("device "+tt.device, func(t *testing.T) {
+			r := get(t, srv, "/api/v1/observingconditions/"+tt.device+"/supportedactions", client("1"))
+
+			var names []string
+			err := json.Unmarshal(r.Value, &names)
+			if err != nil {
+				t.Fatalf("decoding %s: %v", r.Value, err)
+			}
+
+			if slices.Contains(names, "GetFWHMMeasurements") != tt.supported {
+				t.Errorf("supported actions %v, want GetFWHMMeasurements listed %t", names, tt.supported)
+			}
+
+			params := with(with(client("1"), "Action", "GetFWHMMeasurements"), "Parameters", "")
+
+			r = put(t, srv, "/api/v1/observingconditions/"+tt.device+"/action", params)
+			if tt.supported && r.ErrorNumber != 0 {
+				t.Errorf("running the action: error 0x%X %s", r.ErrorNumber, r.ErrorMessage)
+			}
+			if !tt.supported && r.ErrorNumber != 0x40C {
+				t.Errorf("running the action gives error 0x%X, want 0x40C", r.ErrorNumber)
+			}
+		})
+	}
+}
@@ -2,115 +2,130 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/darkdragonsastro/weewx-json-alpaca/alpaca"
-	"github.com/darkdragonsastro/weewx-json-alpaca/logging"
-	"go.uber.org/zap"
+	"github.com/darkdragonsastro/weewx-json-alpaca/middleware"
+	"github.com/darkdragonsastro/weewx-json-alpaca/version"
 )
 
 func (h *Handler) PutAction(w http.ResponseWriter, r *http.Request) {
 	ctx := alpaca.FromContext(r.Context())
 
-	errNumber := 0x400
-	errMessage := "Not implemented"
+	name, err := ctx.Params.String("Action")
+	if err != nil {
+		middleware.BadRequest(w, err.Error())
+		return
+	}
 
-	writeResponse(r, w, http.StatusOK, &AlpacaResponse{
-		ClientTransactionID: ctx.ClientTransactionID,
-		ServerTransactionID: ctx.ServerTransactionID,
-		ErrorNumber:         &errNumber,
-		ErrorMessage:        &errMessage,
+	parameters, err := ctx.Params.String("Parameters")
+	if err != nil {
+		middleware.BadRequest(w, err.Error())
+		return
+	}
+
+	a := h.findAction(r, name)
+	if a == nil {
+		writeError(w, r, ErrActionNotImplemented)
+		return
+	}
+
+	value, err := a.Run(r, parameters)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(r, w, http.StatusOK, &AlpacaStringResponse{
+		AlpacaResponse: AlpacaResponse{
+			ClientTransactionID: ctx.ClientTransactionID,
+			ServerTransactionID: ctx.ServerTransactionID,
+		},
+		Value: value,
 	})
 }
 
 func (h *Handler) PutCommandBlind(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, ErrNotImplemented)
+}
+
+func (h *Handler) PutCommandBool(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, ErrNotImplemented)
+}
+
+func (h *Handler) PutCommandString(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, ErrNotImplemented)
+}
+
+func (h *Handler) GetConnected(w http.ResponseWriter, r *http.Request) {
 	ctx := alpaca.FromContext(r.Context())
 
-	errNumber := 0x400
-	errMessage := "Not implemented"
+	writeResponse(r, w, http.StatusOK, &AlpacaBooleanResponse{
+		AlpacaResponse: AlpacaResponse{
+			ClientTransactionID: ctx.ClientTransactionID,
+			ServerTransactionID: ctx.ServerTransactionID,
+		},
+		Value: h.clientConnected(r),
+	})
+}
+
+func (h *Handler) PutConnected(w http.ResponseWriter, r *http.Request) {
+	ctx := alpaca.FromContext(r.Context())
+
+	connected, err := ctx.Params.Bool("Connected")
+	if err != nil {
+		middleware.BadRequest(w, err.Error())
+		return
+	}
+
+	if connected {
+		h.connect(r, false)
+	} else {
+		h.disconnect(r)
+	}
 
 	writeResponse(r, w, http.StatusOK, &AlpacaResponse{
 		ClientTransactionID: ctx.ClientTransactionID,
 		ServerTransactionID: ctx.ServerTransactionID,
-		ErrorNumber:         &errNumber,
-		ErrorMessage:        &errMessage,
 	})
 }
 
-func (h *Handler) PutCommandBool(w http.ResponseWriter, r *http.Request) {
+// PutConnect starts connecting in the background. Clients poll Connecting to
+// find out when it is done.
+func (h *Handler) PutConnect(w http.ResponseWriter, r *http.Request) {
 	ctx := alpaca.FromContext(r.Context())
 
-	errNumber := 0x400
-	errMessage := "Not implemented"
+	h.connect(r, true)
 
 	writeResponse(r, w, http.StatusOK, &AlpacaResponse{
 		ClientTransactionID: ctx.ClientTransactionID,
 		ServerTransactionID: ctx.ServerTransactionID,
-		ErrorNumber:         &errNumber,
-		ErrorMessage:        &errMessage,
 	})
 }
 
-func (h *Handler) PutCommandString(w http.ResponseWriter, r *http.Request) {
+// PutDisconnect disconnects the client. It completes before the response is
+// sent.
+func (h *Handler) PutDisconnect(w http.ResponseWriter, r *http.Request) {
 	ctx := alpaca.FromContext(r.Context())
 
-	errNumber := 0x400
-	errMessage := "Not implemented"
+	h.disconnect(r)
 
 	writeResponse(r, w, http.StatusOK, &AlpacaResponse{
 		ClientTransactionID: ctx.ClientTransactionID,
 		ServerTransactionID: ctx.ServerTransactionID,
-		ErrorNumber:         &errNumber,
-		ErrorMessage:        &errMessage,
 	})
 }
 
-func (h *Handler) GetConnected(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetConnecting(w http.ResponseWriter, r *http.Request) {
 	ctx := alpaca.FromContext(r.Context())
 
-	oc := h.weewx.GetCurrent()
-
 	writeResponse(r, w, http.StatusOK, &AlpacaBooleanResponse{
 		AlpacaResponse: AlpacaResponse{
 			ClientTransactionID: ctx.ClientTransactionID,
 			ServerTransactionID: ctx.ServerTransactionID,
 		},
-		Value: oc.Connected,
-	})
-}
-
-func (h *Handler) PutConnected(w http.ResponseWriter, r *http.Request) {
-	ctx := alpaca.FromContext(r.Context())
-
-	err := r.ParseForm()
-	if err != nil {
-		logger := logging.FromContext(r.Context())
-		logger.Error("failed to parse form", zap.Error(err))
-
-		writeResponse(r, w, http.StatusBadRequest, nil)
-		return
-	}
-
-	var req AlpacaConnectedRequest
-
-	if strings.ToLower(r.PostForm.Get("Connected")) != "true" && strings.ToLower(r.PostForm.Get("Connected")) != "false" {
-		writeResponse(r, w, http.StatusBadRequest, nil)
-		return
-	}
-
-	err = decoder.Decode(&req, r.PostForm)
-	if err != nil {
-		logger := logging.FromContext(r.Context())
-		logger.Error("failed to parse form", zap.Error(err))
-
-		writeResponse(r, w, http.StatusBadRequest, nil)
-		return
-	}
-
-	writeResponse(r, w, http.StatusOK, &AlpacaResponse{
-		ClientTransactionID: req.ClientTransactionID,
-		ServerTransactionID: ctx.ServerTransactionID,
+		Value: h.device(r).Source.Connecting(),
 	})
 }
 
@@ -122,10 +137,11 @@ func (h *Handler) GetDescription(w http.ResponseWriter, r *http.Request) {
 			ClientTransactionID: ctx.ClientTransactionID,
 			ServerTransactionID: ctx.ServerTransactionID,
 		},
-		Value: "weewx-json-alpaca",
+		Value: h.deviceName(r),
 	})
 }
 
+// GetDriverInfo names the device and the exact build serving it.
 func (h *Handler) GetDriverInfo(w http.ResponseWriter, r *http.Request) {
 	ctx := alpaca.FromContext(r.Context())
 
@@ -134,7 +150,7 @@ func (h *Handler) GetDriverInfo(w http.ResponseWriter, r *http.Request) {
 			ClientTransactionID: ctx.ClientTransactionID,
 			ServerTransactionID: ctx.ServerTransactionID,
 		},
-		Value: "weewx-json-alpaca",
+		Value: fmt.Sprintf("%s, weewx-json-alpaca %s", h.deviceName(r), version.Get()),
 	})
 }
 
@@ -146,19 +162,27 @@ func (h *Handler) GetDriverVersion(w http.ResponseWriter, r *http.Request) {
 			ClientTransactionID: ctx.ClientTransactionID,
 			ServerTransactionID: ctx.ServerTransactionID,
 		},
-		Value: "1.0",
+		Value: version.Get().DriverVersion(),
 	})
 }
 
 func (h *Handler) GetInterfaceVersion(w http.ResponseWriter, r *http.Request) {
 	ctx := alpaca.FromContext(r.Context())
 
+	version := 1
+	if ctx.DeviceType != nil {
+		switch *ctx.DeviceType {
+		case "observingconditions", "switch":
+			version = 2
+		}
+	}
+
 	writeResponse(r, w, http.StatusOK, &AlpacaIntResponse{
 		AlpacaResponse: AlpacaResponse{
 			ClientTransactionID: ctx.ClientTransactionID,
 			ServerTransactionID: ctx.ServerTransactionID,
 		},
-		Value: 1,
+		Value: version,
 	})
 }
 
@@ -170,18 +194,23 @@ func (h *Handler) GetName(w http.ResponseWriter, r *http.Request) {
 			ClientTransactionID: ctx.ClientTransactionID,
 			ServerTransactionID: ctx.ServerTransactionID,
 		},
-		Value: "weewx-json-alpaca",
+		Value: h.deviceName(r),
 	})
 }
 
 func (h *Handler) GetSupportedActions(w http.ResponseWriter, r *http.Request) {
 	ctx := alpaca.FromContext(r.Context())
 
+	names := []string{}
+	for _, a := range h.actions(r) {
+		names = append(names, a.Name)
+	}
+
 	writeResponse(r, w, http.StatusOK, &AlpacaStringArrayResponse{
 		AlpacaResponse: AlpacaResponse{
 			ClientTransactionID: ctx.ClientTransactionID,
 			ServerTransactionID: ctx.ServerTransactionID,
 		},
-		Value: []string{},
+		Value: names,
 	})
 }
@@ -0,0 +1,181 @@
+// Package handler implements the request handlers for the API.
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/weewx"
+)
+
+// Reporter is implemented by sources that can provide the WeeWX report their
+// conditions come from.
+type Reporter interface {
+	// Report returns the last report, parsed and as received. Both are nil
+	// before the first report.
+	Report() (*weewx.WeeWx, []byte)
+}
+
+// conditionProperties are the ObservingConditions properties in the
+// GetAllConditions snapshot, with the units they are served in.
+var conditionProperties = []struct {
+	Property string
+	Sensor   string
+	Units    string
+	Value    func(oc *weewx.ObservingConditions) *float64
+}{
+	{"CloudCover", "cloudcover", "%", func(oc *weewx.ObservingConditions) *float64 { return oc.CloudCover }},
+	{"DewPoint", "dewpoint", "°C", func(oc *weewx.ObservingConditions) *float64 { return oc.DewPoint }},
+	{"Humidity", "humidity", "%", func(oc *weewx.ObservingConditions) *float64 { return oc.Humidity }},
+	{"Pressure", "pressure", "hPa", func(oc *weewx.ObservingConditions) *float64 { return oc.Pressure }},
+	{"RainRate", "rainrate", "mm/h", func(oc *weewx.ObservingConditions) *float64 { return oc.RainRate }},
+	{"SkyBrightness", "skybrightness", "lux", func(oc *weewx.ObservingConditions) *float64 { return oc.SkyBrightness }},
+	{"SkyQuality", "skyquality", "mag/arcsec²", func(oc *weewx.ObservingConditions) *float64 { return oc.SkyQuality }},
+	{"SkyTemperature", "skytemperature", "°C", func(oc *weewx.ObservingConditions) *float64 { return oc.SkyTemperature }},
+	{"Temperature", "temperature", "°C", func(oc *weewx.ObservingConditions) *float64 { return oc.Temperature }},
+	{"WindDirection", "winddirection", "°", func(oc *weewx.ObservingConditions) *float64 { return oc.WindDirection }},
+	{"WindGust", "windgust", "km/h", func(oc *weewx.ObservingConditions) *float64 { return oc.WindGust }},
+	{"WindSpeed", "windspeed", "km/h", func(oc *weewx.ObservingConditions) *float64 { return oc.WindSpeed }},
+}
+
+// ConditionValue is one value in the GetAllConditions snapshot.
+type ConditionValue struct {
+	Value     float64   `json:"value"`
+	Units     string    `json:"units"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// AllConditions is the result of the GetAllConditions action.
+type AllConditions struct {
+	Timestamp  time.Time                 `json:"timestamp"`
+	Conditions map[string]ConditionValue `json:"conditions"`
+}
+
+// allConditionsAction returns every available value of the device, keyed by
+// property name, in a single call.
+func (h *Handler) allConditionsAction(r *http.Request, parameters string) (string, error) {
+	oc, err := h.current(r)
+	if err != nil {
+		return "", err
+	}
+
+	all := AllConditions{
+		Timestamp:  time.Now().UTC(),
+		Conditions: make(map[string]ConditionValue),
+	}
+
+	for _, p := range conditionProperties {
+		v := p.Value(oc)
+		if v == nil || !h.supports(r, p.Sensor) {
+			continue
+		}
+
+		all.Conditions[p.Property] = ConditionValue{
+			Value:     *v,
+			Units:     p.Units,
+			Timestamp: oc.LastUpdated,
+		}
+	}
+
+	if h.supports(r, "starfwhm") {
+		if v := h.fwhm.Current(); v != nil {
+			all.Conditions["StarFWHM"] = ConditionValue{
+				Value:     *v,
+				Units:     "arcsec",
+				Timestamp: h.fwhm.LastUpdated(),
+			}
+		}
+	}
+
+	return marshalAction(all)
+}
+
+// StationInfo is the result of the GetStationInfo action.
+type StationInfo struct {
+	Location  string    `json:"location"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Altitude  float64   `json:"altitude"`
+	Link      string    `json:"link"`
+	Generator string    `json:"generator"`
+	Generated time.Time `json:"generated"`
+}
+
+// stationInfoAction returns the station description from the last report.
+// The altitude is in meters.
+func (h *Handler) stationInfoAction(r *http.Request, parameters string) (string, error) {
+	report, _, err := h.report(r)
+	if err != nil {
+		return "", err
+	}
+
+	return marshalAction(StationInfo{
+		Location:  report.Station.Location,
+		Latitude:  report.Station.Latitude,
+		Longitude: report.Station.Longitude,
+		Altitude:  report.Station.Altitude,
+		Link:      report.Station.Link,
+		Generator: report.Generation.Generator,
+		Generated: report.Generation.Time.Time,
+	})
+}
+
+// rawSourceAction returns the last report exactly as received from WeeWX.
+func (h *Handler) rawSourceAction(r *http.Request, parameters string) (string, error) {
+	_, raw, err := h.report(r)
+	if err != nil {
+		return "", err
+	}
+
+	return string(raw), nil
+}
+
+// ExtendedSensors is the result of the GetExtendedSensors action.
+type ExtendedSensors struct {
+	Timestamp time.Time               `json:"timestamp"`
+	Sensors   map[string]*weewx.Value `json:"sensors"`
+}
+
+// extendedSensorsAction returns the values in the last report that are not
+// ObservingConditions properties, such as the heat index and wind chill, by
+// their WeeWX names and in the units WeeWX reported them in.
+func (h *Handler) extendedSensorsAction(r *http.Request, parameters string) (string, error) {
+	report, _, err := h.report(r)
+	if err != nil {
+		return "", err
+	}
+
+	return marshalAction(ExtendedSensors{
+		Timestamp: report.Generation.Time.Time,
+		Sensors:   report.Current.Extras(),
+	})
+}
+
+// report returns the last report of the device the request is for.
+func (h *Handler) report(r *http.Request) (*weewx.WeeWx, []byte, error) {
+	if !h.clientConnected(r) {
+		return nil, nil, ErrNotConnected
+	}
+
+	reporter, ok := h.device(r).Source.(Reporter)
+	if !ok {
+		return nil, nil, ErrActionNotImplemented
+	}
+
+	report, raw := reporter.Report()
+	if report == nil {
+		return nil, nil, ErrValueNotSet
+	}
+
+	return report, raw, nil
+}
+
+func marshalAction(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
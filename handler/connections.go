@@ -0,0 +1,241 @@
+// Package handler implements the request handlers for the API.
+package handler
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/alpaca"
+)
+
+const (
+	// connectionMaxIdle is how long a client is remembered after its last
+	// request. A client idle for longer is forgotten along with the Connected
+	// state it set.
+	connectionMaxIdle = 24 * time.Hour
+	// connectionSweepInterval is how often the idle clients are forgotten.
+	connectionSweepInterval = time.Minute
+)
+
+// connectionKey identifies one client of one device.
+type connectionKey struct {
+	DeviceType   string
+	DeviceNumber int
+	ClientID     uint64
+}
+
+func connectionKeyFromContext(ctx alpaca.AlpacaContext) connectionKey {
+	var key connectionKey
+
+	if ctx.DeviceType != nil {
+		key.DeviceType = *ctx.DeviceType
+	}
+
+	if ctx.DeviceNumber != nil {
+		key.DeviceNumber = *ctx.DeviceNumber
+	}
+
+	key.ClientID = ctx.ClientID
+
+	return key
+}
+
+// connection is the state of one client of one device.
+type connection struct {
+	// Connected is nil until the client sets it. Until then the client sees
+	// the state of the source.
+	Connected    *bool
+	RemoteAddr   string
+	LastActivity time.Time
+}
+
+// connections tracks the Connected state each client has set, so that one
+// client disconnecting does not disconnect the others.
+type connections struct {
+	mu        sync.Mutex
+	m         map[connectionKey]*connection
+	lastSweep time.Time
+}
+
+func newConnections() *connections {
+	return &connections{
+		m: make(map[connectionKey]*connection),
+	}
+}
+
+// touch records a request from the client. It returns the clients that were
+// forgotten while connected.
+func (c *connections) touch(key connectionKey, remoteAddr string, now time.Time) []connectionKey {
+	var forgotten []connectionKey
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) >= connectionSweepInterval {
+		c.lastSweep = now
+
+		for k, conn := range c.m {
+			if now.Sub(conn.LastActivity) > connectionMaxIdle {
+				if conn.Connected != nil && *conn.Connected {
+					forgotten = append(forgotten, k)
+				}
+				delete(c.m, k)
+			}
+		}
+	}
+
+	conn, ok := c.m[key]
+	if !ok {
+		conn = &connection{}
+		c.m[key] = conn
+	}
+
+	conn.RemoteAddr = remoteAddr
+	conn.LastActivity = now
+
+	return forgotten
+}
+
+// set records the Connected state the client has set.
+func (c *connections) set(key connectionKey, connected bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conn, ok := c.m[key]
+	if !ok {
+		conn = &connection{}
+		c.m[key] = conn
+	}
+
+	conn.Connected = &connected
+}
+
+// disconnected reports whether the client has set Connected to false.
+func (c *connections) disconnected(key connectionKey) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conn, ok := c.m[key]
+	return ok && conn.Connected != nil && !*conn.Connected
+}
+
+// connected returns how many clients matching the filter have set Connected
+// to true.
+func (c *connections) connected(filter func(key connectionKey) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for k, conn := range c.m {
+		if conn.Connected != nil && *conn.Connected && filter(k) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// ClientValue describes a client in the Clients response.
+type ClientValue struct {
+	ClientID     uint64    `json:"ClientID"`
+	DeviceType   string    `json:"DeviceType"`
+	DeviceNumber int       `json:"DeviceNumber"`
+	Connected    bool      `json:"Connected"`
+	RemoteAddr   string    `json:"RemoteAddr"`
+	LastActivity time.Time `json:"LastActivity"`
+}
+
+type ClientsResponse struct {
+	Value []ClientValue `json:"Value"`
+}
+
+// Clients lists the clients that have used the devices recently, with the
+// Connected state each of them sees.
+func (h *Handler) Clients(w http.ResponseWriter, r *http.Request) {
+	h.connections.mu.Lock()
+
+	clients := []ClientValue{}
+	for k, conn := range h.connections.m {
+		connected := h.devices[h.deviceIndex(k.DeviceType, k.DeviceNumber)].Source.GetCurrent().Connected
+		if conn.Connected != nil && !*conn.Connected {
+			connected = false
+		}
+
+		clients = append(clients, ClientValue{
+			ClientID:     k.ClientID,
+			DeviceType:   k.DeviceType,
+			DeviceNumber: k.DeviceNumber,
+			Connected:    connected,
+			RemoteAddr:   conn.RemoteAddr,
+			LastActivity: conn.LastActivity,
+		})
+	}
+
+	h.connections.mu.Unlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].LastActivity.After(clients[j].LastActivity)
+	})
+
+	writeResponse(r, w, http.StatusOK, &ClientsResponse{
+		Value: clients,
+	})
+}
+
+// connect records that the client of the request has connected and starts the
+// source of its device, in case it is not running. When async is set, the
+// source is started in the background.
+func (h *Handler) connect(r *http.Request, async bool) {
+	ctx := alpaca.FromContext(r.Context())
+
+	h.connections.set(connectionKeyFromContext(ctx), true)
+
+	if async {
+		h.device(r).Source.Connect()
+	} else {
+		h.device(r).Source.Start()
+	}
+}
+
+// disconnect records that the client of the request has disconnected, and
+// stops the source of its device when no other client needs it. Only that
+// client sees the device as disconnected.
+func (h *Handler) disconnect(r *http.Request) {
+	ctx := alpaca.FromContext(r.Context())
+
+	key := connectionKeyFromContext(ctx)
+	h.connections.set(key, false)
+	h.release(key)
+}
+
+// release stops the source of the client's device once no client is
+// connected to it, unless the source is shared.
+func (h *Handler) release(key connectionKey) {
+	i := h.deviceIndex(key.DeviceType, key.DeviceNumber)
+	if h.devices[i].Shared {
+		return
+	}
+
+	remaining := h.connections.connected(func(k connectionKey) bool {
+		return h.deviceIndex(k.DeviceType, k.DeviceNumber) == i
+	})
+
+	if remaining == 0 {
+		h.devices[i].Source.Stop()
+	}
+}
+
+// clientConnected reports whether the client of the request sees the device
+// as connected.
+func (h *Handler) clientConnected(r *http.Request) bool {
+	ctx := alpaca.FromContext(r.Context())
+
+	if h.connections.disconnected(connectionKeyFromContext(ctx)) {
+		return false
+	}
+
+	oc := h.device(r).Source.GetCurrent()
+	return oc != nil && oc.Connected
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnectionsForgetIdleClients(t *testing.T) {
+	c := newConnections()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	idle := connectionKey{DeviceType: "observingconditions", ClientID: 1}
+	connected := connectionKey{DeviceType: "observingconditions", ClientID: 2}
+	active := connectionKey{DeviceType: "observingconditions", ClientID: 3}
+
+	c.touch(idle, "a", start)
+	c.touch(connected, "b", start)
+	c.set(connected, false)
+
+	c.touch(active, "c", start.Add(connectionMaxIdle))
+	if len(c.m) != 3 {
+		t.Fatalf("%d clients remembered before they are idle, want 3", len(c.m))
+	}
+
+	c.touch(active, "c", start.Add(connectionMaxIdle+connectionSweepInterval+time.Second))
+	if len(c.m) != 1 {
+		t.Fatalf("%d clients remembered after the others went idle, want 1", len(c.m))
+	}
+
+	if _, ok := c.m[active]; !ok {
+		t.Error("the active client was forgotten")
+	}
+}
@@ -0,0 +1,123 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/conformance"
+	"github.com/darkdragonsastro/weewx-json-alpaca/fwhm"
+)
+
+func TestDisconnectIsPerClient(t *testing.T) {
+	for _, device := range []string{"observingconditions", "safetymonitor", "switch"} {
+		t.Run(device, func(t *testing.T) {
+			srv := newFakeServer(t)
+
+			r := put(t, srv, "/api/v1/"+device+"/0/connected", with(client("2"), "Connected", "False"))
+			if r.Status != 200 || r.ErrorNumber != 0 {
+				t.Fatalf("disconnecting client 2: %d 0x%X %s", r.Status, r.ErrorNumber, r.Body)
+			}
+
+			r = get(t, srv, "/api/v1/"+device+"/0/connected", client("2"))
+			if string(r.Value) != "false" {
+				t.Errorf("client 2 sees Connected %s, want false", r.Value)
+			}
+
+			r = get(t, srv, "/api/v1/observingconditions/0/connected", client("1"))
+			if string(r.Value) != "true" {
+				t.Errorf("client 1 sees Connected %s, want true", r.Value)
+			}
+
+			r = get(t, srv, "/api/v1/observingconditions/0/temperature", client("1"))
+			if r.ErrorNumber != 0 {
+				t.Errorf("client 1 reading temperature: error 0x%X %s", r.ErrorNumber, r.ErrorMessage)
+			}
+
+			var temperature float64
+			err := json.Unmarshal(r.Value, &temperature)
+			if err != nil || temperature == 0 {
+				t.Errorf("client 1 reading temperature: %s", r.Value)
+			}
+		})
+	}
+}
+
+func TestDisconnectedClientGetsNoStarFWHM(t *testing.T) {
+	store := fwhm.NewStore(fwhm.ModeLatest, time.Minute, time.Hour)
+	store.Add(fwhm.Measurement{FWHM: 2.4, Timestamp: time.Now()})
+
+	srv := newServer(t, store, conformance.NewFakeSource())
+
+	put(t, srv, "/api/v1/observingconditions/0/connected", with(client("2"), "Connected", "False"))
+
+	for _, tt := range []struct {
+		path   string
+		params url.Values
+	}{
+		{"starfwhm", nil},
+		{"timesincelastupdate", url.Values{"SensorName": {"StarFWHM"}}},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			params := client("2")
+			for k, v := range tt.params {
+				params[k] = v
+			}
+
+			r := get(t, srv, "/api/v1/observingconditions/0/"+tt.path, params)
+			if r.ErrorNumber != 0x407 {
+				t.Errorf("disconnected client 2 gets error 0x%X, want 0x407", r.ErrorNumber)
+			}
+
+			params.Set("ClientID", "1")
+
+			r = get(t, srv, "/api/v1/observingconditions/0/"+tt.path, params)
+			if r.ErrorNumber != 0 {
+				t.Errorf("connected client 1 gets error 0x%X %s", r.ErrorNumber, r.ErrorMessage)
+			}
+		})
+	}
+}
+
+func TestLastDisconnectStopsUnsharedSource(t *testing.T) {
+	shared := conformance.NewFakeSource()
+	unshared := conformance.NewFakeSource()
+
+	srv := newServer(t, nil, shared, unshared)
+
+	connected := func(device, id string) string {
+		return string(get(t, srv, "/api/v1/observingconditions/"+device+"/connected", client(id)).Value)
+	}
+
+	for _, id := range []string{"1", "2"} {
+		put(t, srv, "/api/v1/observingconditions/1/connected", with(client(id), "Connected", "True"))
+	}
+
+	put(t, srv, "/api/v1/observingconditions/1/connected", with(client("2"), "Connected", "False"))
+	if !unshared.GetCurrent().Connected {
+		t.Fatal("source stopped while client 1 is still connected")
+	}
+	if got := connected("1", "1"); got != "true" {
+		t.Errorf("client 1 sees Connected %s, want true", got)
+	}
+
+	put(t, srv, "/api/v1/observingconditions/1/disconnect", client("1"))
+	if unshared.GetCurrent().Connected {
+		t.Error("source still running after the last client disconnected")
+	}
+	if got := connected("1", "3"); got != "false" {
+		t.Errorf("client 3 sees Connected %s after the source stopped, want false", got)
+	}
+
+	put(t, srv, "/api/v1/observingconditions/1/connected", with(client("3"), "Connected", "True"))
+	if got := connected("1", "3"); got != "true" {
+		t.Errorf("client 3 sees Connected %s after connecting, want true", got)
+	}
+
+	put(t, srv, "/api/v1/observingconditions/0/connected", with(client("1"), "Connected", "True"))
+	put(t, srv, "/api/v1/observingconditions/0/connected", with(client("1"), "Connected", "False"))
+	if !shared.GetCurrent().Connected {
+		t.Error("the source shared with the safety monitor was stopped")
+	}
+}
@@ -0,0 +1,127 @@
+// Package handler implements the request handlers for the API.
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/alpaca"
+	"github.com/darkdragonsastro/weewx-json-alpaca/middleware"
+	"github.com/darkdragonsastro/weewx-json-alpaca/weewx"
+)
+
+// Source provides the conditions of a device.
+type Source interface {
+	GetCurrent() *weewx.ObservingConditions
+	// Supports reports whether the named sensor is available. The name is
+	// the lower case Alpaca property name.
+	Supports(sensor string) bool
+
+	// Start and Stop connect and disconnect the source synchronously.
+	Start()
+	Stop()
+	// Connect starts the source in the background, reporting Connecting
+	// until it is done.
+	Connect()
+	Connecting() bool
+}
+
+// Device is an ObservingConditions device served by the handler.
+type Device struct {
+	Name     string
+	UniqueID string
+	Source   Source
+
+	// Shared is set when the source is also used by the safety monitor and
+	// the switches, or by another device. A shared source keeps running when
+	// its clients disconnect; the others are stopped once none is connected.
+	Shared bool
+}
+
+// deviceCount returns how many devices of the given type are configured.
+func (h *Handler) deviceCount(deviceType string) int {
+	switch deviceType {
+	case "observingconditions":
+		return len(h.devices)
+	case "safetymonitor", "switch":
+		return 1
+	}
+
+	return 0
+}
+
+// ValidDevice rejects requests for device numbers that are not configured
+// with the 400 response the Alpaca specification requires. Requests to the
+// device API are recorded as client activity.
+func (h *Handler) ValidDevice(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := alpaca.FromContext(r.Context())
+
+		if ctx.DeviceType == nil || ctx.DeviceNumber == nil ||
+			*ctx.DeviceNumber < 0 || *ctx.DeviceNumber >= h.deviceCount(*ctx.DeviceType) {
+			middleware.BadRequest(w, "Invalid device number")
+			return
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			forgotten := h.connections.touch(connectionKeyFromContext(ctx), r.RemoteAddr, time.Now())
+			for _, key := range forgotten {
+				h.release(key)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// device returns the ObservingConditions device the request is for. The
+// safety monitor and switch are driven by the first device.
+func (h *Handler) device(r *http.Request) *Device {
+	ctx := alpaca.FromContext(r.Context())
+
+	if ctx.DeviceType == nil || ctx.DeviceNumber == nil {
+		return &h.devices[0]
+	}
+
+	return &h.devices[h.deviceIndex(*ctx.DeviceType, *ctx.DeviceNumber)]
+}
+
+// deviceIndex returns the index of the ObservingConditions device behind the
+// given Alpaca device.
+func (h *Handler) deviceIndex(deviceType string, deviceNumber int) int {
+	if deviceType == "observingconditions" {
+		return deviceNumber
+	}
+
+	return 0
+}
+
+// deviceName returns the name of the device the request is for.
+func (h *Handler) deviceName(r *http.Request) string {
+	ctx := alpaca.FromContext(r.Context())
+
+	if ctx.DeviceType != nil {
+		switch *ctx.DeviceType {
+		case "safetymonitor":
+			return h.identity.SafetyMonitorName
+		case "switch":
+			return h.identity.SwitchName
+		}
+	}
+
+	return h.device(r).Name
+}
+
+// supports reports whether the named sensor is available on the device the
+// request is for. The name is the lower case Alpaca property name. Star FWHM
+// is only available on the first device.
+func (h *Handler) supports(r *http.Request, sensor string) bool {
+	d := h.device(r)
+
+	if sensor == "starfwhm" {
+		return h.fwhm != nil && d == &h.devices[0]
+	}
+
+	return d.Source.Supports(sensor)
+}
@@ -0,0 +1,53 @@
+// Package handler implements the request handlers for the API.
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/alpaca"
+)
+
+// AlpacaError is an error reported to the client in the ErrorNumber and
+// ErrorMessage of a 200 response, as the Alpaca specification requires.
+type AlpacaError struct {
+	Number  int
+	Message string
+}
+
+func (e *AlpacaError) Error() string {
+	return e.Message
+}
+
+// The errors defined by the Alpaca specification that the handlers return.
+var (
+	ErrNotImplemented       = &AlpacaError{Number: 0x400, Message: "Not implemented"}
+	ErrInvalidValue         = &AlpacaError{Number: 0x401, Message: "Invalid value"}
+	ErrValueNotSet          = &AlpacaError{Number: 0x402, Message: "Value not set"}
+	ErrNotConnected         = &AlpacaError{Number: 0x407, Message: "Not connected"}
+	ErrActionNotImplemented = &AlpacaError{Number: 0x40C, Message: "Action not implemented"}
+)
+
+// DriverError returns a driver specific error. The number must be between
+// 0x500 and 0xFFF.
+func DriverError(number int, message string) *AlpacaError {
+	return &AlpacaError{Number: number, Message: message}
+}
+
+// writeError writes the Alpaca error response for err. Errors that are not an
+// AlpacaError are reported as the generic driver error 0x500.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	ctx := alpaca.FromContext(r.Context())
+
+	var alpacaErr *AlpacaError
+	if !errors.As(err, &alpacaErr) {
+		alpacaErr = DriverError(0x500, err.Error())
+	}
+
+	writeResponse(r, w, http.StatusOK, &AlpacaResponse{
+		ClientTransactionID: ctx.ClientTransactionID,
+		ServerTransactionID: ctx.ServerTransactionID,
+		ErrorNumber:         &alpacaErr.Number,
+		ErrorMessage:        &alpacaErr.Message,
+	})
+}
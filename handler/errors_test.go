@@ -0,0 +1,138 @@
+package handler_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/weewx"
+)
+
+// stubSource serves fixed conditions, with only the given sensors supported.
+type stubSource struct {
+	oc        *weewx.ObservingConditions
+	supported map[string]bool
+}
+
+func (s *stubSource) GetCurrent() *weewx.ObservingConditions { return s.oc }
+func (s *stubSource) Supports(sensor string) bool            { return s.supported[sensor] }
+func (s *stubSource) Start()                                 {}
+func (s *stubSource) Stop()                                  {}
+func (s *stubSource) Connect()                               {}
+func (s *stubSource) Connecting() bool                       { return false }
+
+func TestAlpacaErrors(t *testing.T) {
+	connected := newServer(t, nil, &stubSource{
+		oc: &weewx.ObservingConditions{
+			Connected:   true,
+			LastUpdated: time.Now(),
+		},
+		supported: map[string]bool{"temperature": true},
+	})
+
+	disconnected := newServer(t, nil, &stubSource{
+		oc:        &weewx.ObservingConditions{},
+		supported: map[string]bool{"temperature": true},
+	})
+
+	for _, tt := range []struct {
+		name    string
+		res     func() *response
+		number  int
+		message string
+	}{
+		{
+			name: "invalid value",
+			res: func() *response {
+				return put(t, connected, "/api/v1/observingconditions/0/averageperiod", with(client("1"), "AveragePeriod", "5"))
+			},
+			number:  0x401,
+			message: "Invalid value",
+		},
+		{
+			name: "value not set",
+			res: func() *response {
+				return get(t, connected, "/api/v1/observingconditions/0/temperature", client("1"))
+			},
+			number:  0x402,
+			message: "Value not set",
+		},
+		{
+			name: "not connected",
+			res: func() *response {
+				return get(t, disconnected, "/api/v1/observingconditions/0/temperature", client("1"))
+			},
+			number:  0x407,
+			message: "Not connected",
+		},
+		{
+			name: "device state while not connected",
+			res: func() *response {
+				return get(t, disconnected, "/api/v1/observingconditions/0/devicestate", client("1"))
+			},
+			number:  0x407,
+			message: "Not connected",
+		},
+		{
+			name: "not implemented",
+			res: func() *response {
+				return get(t, connected, "/api/v1/observingconditions/0/skyquality", client("1"))
+			},
+			number:  0x400,
+			message: "Not implemented",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.res()
+
+			if r.Status != http.StatusOK {
+				t.Fatalf("status %d, want 200: %s", r.Status, r.Body)
+			}
+
+			if r.ErrorNumber != tt.number || r.ErrorMessage != tt.message {
+				t.Errorf("error 0x%X %q, want 0x%X %q", r.ErrorNumber, r.ErrorMessage, tt.number, tt.message)
+			}
+		})
+	}
+}
+
+func TestBadParameters(t *testing.T) {
+	srv := newFakeServer(t)
+
+	for _, tt := range []struct {
+		name string
+		res  func() *response
+	}{
+		{
+			name: "malformed value",
+			res: func() *response {
+				return put(t, srv, "/api/v1/observingconditions/0/averageperiod", with(client("1"), "AveragePeriod", "soon"))
+			},
+		},
+		{
+			name: "missing value",
+			res: func() *response {
+				return put(t, srv, "/api/v1/observingconditions/0/connected", client("1"))
+			},
+		},
+		{
+			name: "malformed client id",
+			res: func() *response {
+				return get(t, srv, "/api/v1/observingconditions/0/temperature", with(client("1"), "ClientID", "abc"))
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.res()
+
+			if r.Status != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400: %s", r.Status, r.Body)
+			}
+
+			if body := strings.TrimSpace(r.Body); body == "" || strings.HasPrefix(body, "{") {
+				t.Errorf("body %q, want a plain text message", r.Body)
+			}
+		})
+	}
+}
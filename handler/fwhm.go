@@ -0,0 +1,93 @@
+// Package handler implements the request handlers for the API.
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/fwhm"
+	"github.com/darkdragonsastro/weewx-json-alpaca/logging"
+	"github.com/darkdragonsastro/weewx-json-alpaca/tracing"
+)
+
+// FWHMRequest is the body of a star FWHM measurement pushed by an imaging
+// application.
+type FWHMRequest struct {
+	FWHM      float64    `json:"fwhm"`
+	Timestamp *time.Time `json:"timestamp"`
+	Filter    string     `json:"filter"`
+	Exposure  float64    `json:"exposure"`
+	Source    string     `json:"source"`
+}
+
+// PostFWHM records a star FWHM measurement.
+func (h *Handler) PostFWHM(w http.ResponseWriter, r *http.Request) {
+	if h.fwhm == nil {
+		h.NotFound(w, r)
+		return
+	}
+
+	var req FWHMRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("failed to decode fwhm measurement", zap.Error(err))
+
+		writeResponse(r, w, http.StatusBadRequest, &SimpleResponse{
+			TraceID: tracing.FromContext(r.Context()),
+			Message: "invalid request body",
+		})
+		return
+	}
+
+	if req.FWHM <= 0 {
+		writeResponse(r, w, http.StatusBadRequest, &SimpleResponse{
+			TraceID: tracing.FromContext(r.Context()),
+			Message: "fwhm must be greater than zero",
+		})
+		return
+	}
+
+	timestamp := time.Now()
+	if req.Timestamp != nil {
+		timestamp = *req.Timestamp
+	}
+
+	h.fwhm.Add(fwhm.Measurement{
+		FWHM:      req.FWHM,
+		Timestamp: timestamp,
+		Filter:    req.Filter,
+		Exposure:  req.Exposure,
+		Source:    req.Source,
+	})
+
+	writeResponse(r, w, http.StatusOK, &SimpleResponse{
+		TraceID: tracing.FromContext(r.Context()),
+		Message: "OK",
+	})
+}
+
+// fwhmMeasurementsAction returns the recent FWHM measurements as JSON. The
+// optional parameter is a duration such as "1h" limiting how far back to go.
+func (h *Handler) fwhmMeasurementsAction(r *http.Request, parameters string) (string, error) {
+	var since time.Time
+
+	if parameters != "" {
+		d, err := time.ParseDuration(parameters)
+		if err != nil {
+			return "", ErrInvalidValue
+		}
+
+		since = time.Now().Add(-d)
+	}
+
+	measurements := h.fwhm.Measurements(since)
+	if measurements == nil {
+		measurements = []fwhm.Measurement{}
+	}
+
+	return marshalAction(measurements)
+}
@@ -2,28 +2,41 @@
 package handler
 
 import (
-	"context"
 	"net/http"
-	"strconv"
-
-	"github.com/go-chi/chi"
-	"github.com/gorilla/schema"
 
+	"github.com/darkdragonsastro/weewx-json-alpaca/fwhm"
+	"github.com/darkdragonsastro/weewx-json-alpaca/safety"
+	"github.com/darkdragonsastro/weewx-json-alpaca/settings"
+	"github.com/darkdragonsastro/weewx-json-alpaca/switches"
 	"github.com/darkdragonsastro/weewx-json-alpaca/tracing"
-	"github.com/darkdragonsastro/weewx-json-alpaca/weewx"
 )
 
-var decoder = schema.NewDecoder()
-
 // Handler has all the functions needed to serve our api.
 type Handler struct {
-	weewx *weewx.Client
+	devices  []Device
+	fwhm     *fwhm.Store
+	safety   *safety.Monitor
+	switches []switches.Switch
+	settings *settings.Store
+	identity Identity
+
+	connections *connections
 }
 
-// New creates a new handler.
-func New(weewxClient *weewx.Client) *Handler {
+// New creates a new handler serving the given ObservingConditions devices,
+// numbered in order. There must be at least one device. The fwhm store may be
+// nil when star FWHM measurements are not accepted, and the settings store nil
+// when changes from the setup pages are not to be saved.
+func New(devices []Device, fwhmStore *fwhm.Store, safetyMonitor *safety.Monitor, sw []switches.Switch, settingsStore *settings.Store, identity Identity) *Handler {
 	return &Handler{
-		weewx: weewxClient,
+		devices:  devices,
+		fwhm:     fwhmStore,
+		safety:   safetyMonitor,
+		switches: sw,
+		settings: settingsStore,
+		identity: identity,
+
+		connections: newConnections(),
 	}
 }
 
@@ -50,9 +63,3 @@ func (h *Handler) NotFound(w http.ResponseWriter, r *http.Request) {
 		Message: "not found",
 	})
 }
-
-func routeParamInt(ctx context.Context, name string) int {
-	// this func should only be called for params that are guaranteed to be ints.
-	val, _ := strconv.Atoi(chi.RouteContext(ctx).URLParam("id")) // nolint
-	return val
-}
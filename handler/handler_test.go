@@ -0,0 +1,148 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/conformance"
+	"github.com/darkdragonsastro/weewx-json-alpaca/fwhm"
+	"github.com/darkdragonsastro/weewx-json-alpaca/handler"
+	"github.com/darkdragonsastro/weewx-json-alpaca/router"
+	"github.com/darkdragonsastro/weewx-json-alpaca/safety"
+)
+
+// response is a decoded Alpaca response.
+type response struct {
+	Status int
+	Body   string
+
+	ErrorNumber  int
+	ErrorMessage string
+	Value        json.RawMessage
+}
+
+// newServer starts the router serving an ObservingConditions device backed
+// by each source. The first source is shared with the safety monitor. The
+// store may be nil when star FWHM is not measured.
+func newServer(t *testing.T, store *fwhm.Store, sources ...handler.Source) *httptest.Server {
+	t.Helper()
+
+	log := zap.NewNop()
+
+	monitor := safety.NewMonitor(safety.Rules{}, sources[0].GetCurrent, time.Second, log)
+
+	var devices []handler.Device
+	for i, source := range sources {
+		devices = append(devices, handler.Device{
+			Name:     fmt.Sprintf("test %d", i),
+			UniqueID: fmt.Sprintf("test-%d", i),
+			Source:   source,
+			Shared:   i == 0,
+		})
+	}
+
+	h := handler.New(devices, store, monitor, nil, nil, handler.Identity{
+		ServerName:            "test",
+		SafetyMonitorName:     "test safety monitor",
+		SafetyMonitorUniqueID: "test-safetymonitor",
+		SwitchName:            "test switch",
+		SwitchUniqueID:        "test-switch",
+	})
+
+	srv := httptest.NewServer(router.NewRouter(h, log, "", ""))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func get(t *testing.T, srv *httptest.Server, path string, params url.Values) *response {
+	t.Helper()
+
+	u := srv.URL + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	res, err := http.Get(u)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+
+	return decode(t, res)
+}
+
+func put(t *testing.T, srv *httptest.Server, path string, params url.Values) *response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPut, srv.URL+path, strings.NewReader(params.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT %s: %v", path, err)
+	}
+
+	return decode(t, res)
+}
+
+func decode(t *testing.T, res *http.Response) *response {
+	t.Helper()
+
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &response{
+		Status: res.StatusCode,
+		Body:   string(b),
+	}
+
+	if res.StatusCode == http.StatusOK {
+		err = json.Unmarshal(b, r)
+		if err != nil {
+			t.Fatalf("decoding %s: %v", b, err)
+		}
+	}
+
+	return r
+}
+
+// client returns the parameters identifying a client.
+func client(id string) url.Values {
+	return url.Values{
+		"ClientID":            {id},
+		"ClientTransactionID": {"1"},
+	}
+}
+
+func with(params url.Values, key, value string) url.Values {
+	v := url.Values{}
+	for k, vs := range params {
+		v[k] = vs
+	}
+	v.Set(key, value)
+
+	return v
+}
+
+// newFakeServer starts a server backed by a connected fake source.
+func newFakeServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	return newServer(t, nil, conformance.NewFakeSource())
+}
@@ -0,0 +1,33 @@
+// Package handler implements the request handlers for the API.
+package handler
+
+// Identity describes the server in its management description, and the
+// devices that are not ObservingConditions devices.
+type Identity struct {
+	ServerName   string
+	Manufacturer string
+
+	// Location is where the server is. When empty, the station location in
+	// the report of the first device is used.
+	Location string
+
+	SafetyMonitorName     string
+	SafetyMonitorUniqueID string
+	SwitchName            string
+	SwitchUniqueID        string
+}
+
+// location returns the configured location, or else the one WeeWX reports.
+func (h *Handler) location() string {
+	if h.identity.Location != "" {
+		return h.identity.Location
+	}
+
+	if reporter, ok := h.devices[0].Source.(Reporter); ok {
+		if report, _ := reporter.Report(); report != nil && report.Station.Location != "" {
+			return report.Station.Location
+		}
+	}
+
+	return "Unknown"
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/darkdragonsastro/weewx-json-alpaca/alpaca"
+	"github.com/darkdragonsastro/weewx-json-alpaca/version"
 )
 
 func (h *Handler) ApiVersions(w http.ResponseWriter, r *http.Request) {
@@ -40,10 +41,10 @@ func (h *Handler) Description(w http.ResponseWriter, r *http.Request) {
 			ServerTransactionID: ctx.ServerTransactionID,
 		},
 		Value: DescriptionValue{
-			ServerName:          "weewx-json-alpaca",
-			Manufacturer:        "darkdragons",
-			ManufacturerVersion: "0.0.1",
-			Location:            "Earth",
+			ServerName:          h.identity.ServerName,
+			Manufacturer:        h.identity.Manufacturer,
+			ManufacturerVersion: version.Get().String(),
+			Location:            h.location(),
 		},
 	})
 }
@@ -68,13 +69,41 @@ func (h *Handler) ConfiguredDevices(w http.ResponseWriter, r *http.Request) {
 			ClientTransactionID: ctx.ClientTransactionID,
 			ServerTransactionID: ctx.ServerTransactionID,
 		},
-		Value: []ConfiguredDevicesValue{
-			{
-				DeviceName:   "weewx-json-alpaca",
-				DeviceType:   "observingconditions",
-				DeviceNumber: 0,
-				UniqueID:     h.weewx.Url,
-			},
-		},
+		Value: h.Configured(),
 	})
 }
+
+// Configured returns the devices served, as listed by configureddevices.
+func (h *Handler) Configured() []ConfiguredDevicesValue {
+	devices := []ConfiguredDevicesValue{}
+	for i, d := range h.devices {
+		devices = append(devices, ConfiguredDevicesValue{
+			DeviceName:   d.Name,
+			DeviceType:   "observingconditions",
+			DeviceNumber: i,
+			UniqueID:     d.UniqueID,
+		})
+	}
+
+	devices = append(devices,
+		ConfiguredDevicesValue{
+			DeviceName:   h.identity.SafetyMonitorName,
+			DeviceType:   "safetymonitor",
+			DeviceNumber: 0,
+			UniqueID:     h.identity.SafetyMonitorUniqueID,
+		},
+		ConfiguredDevicesValue{
+			DeviceName:   h.identity.SwitchName,
+			DeviceType:   "switch",
+			DeviceNumber: 0,
+			UniqueID:     h.identity.SwitchUniqueID,
+		},
+	)
+
+	return devices
+}
+
+// Version describes the build that is running.
+func (h *Handler) Version(w http.ResponseWriter, r *http.Request) {
+	writeResponse(r, w, http.StatusOK, version.Get())
+}
@@ -3,115 +3,71 @@ package handler
 
 import (
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/darkdragonsastro/weewx-json-alpaca/alpaca"
-	"github.com/darkdragonsastro/weewx-json-alpaca/tracing"
+	"github.com/darkdragonsastro/weewx-json-alpaca/middleware"
+	"github.com/darkdragonsastro/weewx-json-alpaca/weewx"
 )
 
-func (h *Handler) GetAveragePeriod(w http.ResponseWriter, r *http.Request) {
-	ctx := alpaca.FromContext(r.Context())
-
-	oc := h.weewx.GetCurrent()
-	if oc == nil {
-		writeResponse(r, w, http.StatusInternalServerError, &SimpleResponse{
-			TraceID: tracing.FromContext(r.Context()),
-			Message: "observing conditions is nil",
-		})
-		return
-	}
-
-	writeResponse(r, w, http.StatusOK, &AlpacaFloatResponse{
-		AlpacaResponse: AlpacaResponse{
-			ClientTransactionID: ctx.ClientTransactionID,
-			ServerTransactionID: ctx.ServerTransactionID,
-		},
-		Value: oc.AveragePeriod,
-	})
+// sensors are the lower case names of the sensors an ObservingConditions
+// device can have.
+var sensors = []string{
+	"cloudcover",
+	"dewpoint",
+	"humidity",
+	"pressure",
+	"rainrate",
+	"skybrightness",
+	"skyquality",
+	"skytemperature",
+	"starfwhm",
+	"temperature",
+	"winddirection",
+	"windgust",
+	"windspeed",
 }
 
-func (h *Handler) PutAveragePeriod(w http.ResponseWriter, r *http.Request) {
-	ctx := alpaca.FromContext(r.Context())
-
-	averagePeriod, err := strconv.ParseFloat(r.Form.Get("AveragePeriod"), 64)
-	if err != nil {
-		errNumber := 0x401
-		errMessage := "Invalid Value"
-
-		writeResponse(r, w, http.StatusBadRequest, &AlpacaResponse{
-			ClientTransactionID: ctx.ClientTransactionID,
-			ServerTransactionID: ctx.ServerTransactionID,
-			ErrorNumber:         &errNumber,
-			ErrorMessage:        &errMessage,
-		})
-		return
-	}
-
-	if averagePeriod != 0.0 {
-		errNumber := 0x401
-		errMessage := "Invalid Value"
-
-		writeResponse(r, w, http.StatusOK, &AlpacaResponse{
-			ClientTransactionID: ctx.ClientTransactionID,
-			ServerTransactionID: ctx.ServerTransactionID,
-			ErrorNumber:         &errNumber,
-			ErrorMessage:        &errMessage,
-		})
-		return
+func isSensor(name string) bool {
+	for _, s := range sensors {
+		if s == name {
+			return true
+		}
 	}
 
-	writeResponse(r, w, http.StatusOK, &AlpacaResponse{
-		ClientTransactionID: ctx.ClientTransactionID,
-		ServerTransactionID: ctx.ServerTransactionID,
-	})
+	return false
 }
 
-func (h *Handler) GetCloudCover(w http.ResponseWriter, r *http.Request) {
-	ctx := alpaca.FromContext(r.Context())
-
-	errNumber := 0x400
-	errMessage := "Not implemented"
+// current returns the conditions of the device the request is for, or
+// ErrNotConnected when there are none or the client has disconnected.
+func (h *Handler) current(r *http.Request) (*weewx.ObservingConditions, error) {
+	if !h.clientConnected(r) {
+		return nil, ErrNotConnected
+	}
 
-	writeResponse(r, w, http.StatusOK, &AlpacaResponse{
-		ClientTransactionID: ctx.ClientTransactionID,
-		ServerTransactionID: ctx.ServerTransactionID,
-		ErrorNumber:         &errNumber,
-		ErrorMessage:        &errMessage,
-	})
+	return h.device(r).Source.GetCurrent(), nil
 }
 
-func (h *Handler) GetDewPoint(w http.ResponseWriter, r *http.Request) {
+// writeSensor writes the value of the named sensor, or the error explaining
+// why there is none.
+func (h *Handler) writeSensor(w http.ResponseWriter, r *http.Request, sensor string, value func(oc *weewx.ObservingConditions) *float64) {
 	ctx := alpaca.FromContext(r.Context())
 
-	oc := h.weewx.GetCurrent()
-	if oc == nil || oc.DewPoint == nil {
-		writeResponse(r, w, http.StatusInternalServerError, &SimpleResponse{
-			TraceID: tracing.FromContext(r.Context()),
-			Message: "observing conditions is nil",
-		})
+	if !h.supports(r, sensor) {
+		writeError(w, r, ErrNotImplemented)
 		return
 	}
 
-	writeResponse(r, w, http.StatusOK, &AlpacaFloatResponse{
-		AlpacaResponse: AlpacaResponse{
-			ClientTransactionID: ctx.ClientTransactionID,
-			ServerTransactionID: ctx.ServerTransactionID,
-		},
-		Value: *oc.DewPoint,
-	})
-}
-
-func (h *Handler) GetHumidity(w http.ResponseWriter, r *http.Request) {
-	ctx := alpaca.FromContext(r.Context())
+	oc, err := h.current(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	oc := h.weewx.GetCurrent()
-	if oc == nil || oc.Humidity == nil {
-		writeResponse(r, w, http.StatusInternalServerError, &SimpleResponse{
-			TraceID: tracing.FromContext(r.Context()),
-			Message: "observing conditions is nil",
-		})
+	v := value(oc)
+	if v == nil {
+		writeError(w, r, ErrValueNotSet)
 		return
 	}
 
@@ -120,19 +76,16 @@ func (h *Handler) GetHumidity(w http.ResponseWriter, r *http.Request) {
 			ClientTransactionID: ctx.ClientTransactionID,
 			ServerTransactionID: ctx.ServerTransactionID,
 		},
-		Value: *oc.Humidity,
+		Value: *v,
 	})
 }
 
-func (h *Handler) GetPressure(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetAveragePeriod(w http.ResponseWriter, r *http.Request) {
 	ctx := alpaca.FromContext(r.Context())
 
-	oc := h.weewx.GetCurrent()
-	if oc == nil || oc.Pressure == nil {
-		writeResponse(r, w, http.StatusInternalServerError, &SimpleResponse{
-			TraceID: tracing.FromContext(r.Context()),
-			Message: "observing conditions is nil",
-		})
+	oc, err := h.current(r)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
@@ -141,117 +94,81 @@ func (h *Handler) GetPressure(w http.ResponseWriter, r *http.Request) {
 			ClientTransactionID: ctx.ClientTransactionID,
 			ServerTransactionID: ctx.ServerTransactionID,
 		},
-		Value: *oc.Pressure,
+		Value: oc.AveragePeriod,
 	})
 }
 
-func (h *Handler) GetRainRate(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) PutAveragePeriod(w http.ResponseWriter, r *http.Request) {
 	ctx := alpaca.FromContext(r.Context())
 
-	oc := h.weewx.GetCurrent()
-	if oc == nil || oc.RainRate == nil {
-		writeResponse(r, w, http.StatusInternalServerError, &SimpleResponse{
-			TraceID: tracing.FromContext(r.Context()),
-			Message: "observing conditions is nil",
-		})
+	averagePeriod, err := ctx.Params.Float("AveragePeriod")
+	if err != nil {
+		middleware.BadRequest(w, err.Error())
 		return
 	}
 
-	writeResponse(r, w, http.StatusOK, &AlpacaFloatResponse{
-		AlpacaResponse: AlpacaResponse{
-			ClientTransactionID: ctx.ClientTransactionID,
-			ServerTransactionID: ctx.ServerTransactionID,
-		},
-		Value: *oc.RainRate,
-	})
-}
-
-func (h *Handler) GetSkyBrightness(w http.ResponseWriter, r *http.Request) {
-	ctx := alpaca.FromContext(r.Context())
-
-	errNumber := 0x400
-	errMessage := "Not implemented"
+	// Only instantaneous values are available.
+	if averagePeriod != 0.0 {
+		writeError(w, r, ErrInvalidValue)
+		return
+	}
 
 	writeResponse(r, w, http.StatusOK, &AlpacaResponse{
 		ClientTransactionID: ctx.ClientTransactionID,
 		ServerTransactionID: ctx.ServerTransactionID,
-		ErrorNumber:         &errNumber,
-		ErrorMessage:        &errMessage,
 	})
 }
 
-func (h *Handler) GetSkyQuality(w http.ResponseWriter, r *http.Request) {
-	ctx := alpaca.FromContext(r.Context())
-
-	errNumber := 0x400
-	errMessage := "Not implemented"
+func (h *Handler) GetCloudCover(w http.ResponseWriter, r *http.Request) {
+	h.writeSensor(w, r, "cloudcover", func(oc *weewx.ObservingConditions) *float64 { return oc.CloudCover })
+}
 
-	writeResponse(r, w, http.StatusOK, &AlpacaResponse{
-		ClientTransactionID: ctx.ClientTransactionID,
-		ServerTransactionID: ctx.ServerTransactionID,
-		ErrorNumber:         &errNumber,
-		ErrorMessage:        &errMessage,
-	})
+func (h *Handler) GetDewPoint(w http.ResponseWriter, r *http.Request) {
+	h.writeSensor(w, r, "dewpoint", func(oc *weewx.ObservingConditions) *float64 { return oc.DewPoint })
 }
 
-func (h *Handler) GetSkyTemperature(w http.ResponseWriter, r *http.Request) {
-	ctx := alpaca.FromContext(r.Context())
+func (h *Handler) GetHumidity(w http.ResponseWriter, r *http.Request) {
+	h.writeSensor(w, r, "humidity", func(oc *weewx.ObservingConditions) *float64 { return oc.Humidity })
+}
 
-	errNumber := 0x400
-	errMessage := "Not implemented"
+func (h *Handler) GetPressure(w http.ResponseWriter, r *http.Request) {
+	h.writeSensor(w, r, "pressure", func(oc *weewx.ObservingConditions) *float64 { return oc.Pressure })
+}
 
-	writeResponse(r, w, http.StatusOK, &AlpacaResponse{
-		ClientTransactionID: ctx.ClientTransactionID,
-		ServerTransactionID: ctx.ServerTransactionID,
-		ErrorNumber:         &errNumber,
-		ErrorMessage:        &errMessage,
-	})
+func (h *Handler) GetRainRate(w http.ResponseWriter, r *http.Request) {
+	h.writeSensor(w, r, "rainrate", func(oc *weewx.ObservingConditions) *float64 { return oc.RainRate })
 }
 
-func (h *Handler) GetStarFWHM(w http.ResponseWriter, r *http.Request) {
-	ctx := alpaca.FromContext(r.Context())
+func (h *Handler) GetSkyBrightness(w http.ResponseWriter, r *http.Request) {
+	h.writeSensor(w, r, "skybrightness", func(oc *weewx.ObservingConditions) *float64 { return oc.SkyBrightness })
+}
 
-	errNumber := 0x400
-	errMessage := "Not implemented"
+func (h *Handler) GetSkyQuality(w http.ResponseWriter, r *http.Request) {
+	h.writeSensor(w, r, "skyquality", func(oc *weewx.ObservingConditions) *float64 { return oc.SkyQuality })
+}
 
-	writeResponse(r, w, http.StatusOK, &AlpacaResponse{
-		ClientTransactionID: ctx.ClientTransactionID,
-		ServerTransactionID: ctx.ServerTransactionID,
-		ErrorNumber:         &errNumber,
-		ErrorMessage:        &errMessage,
-	})
+func (h *Handler) GetSkyTemperature(w http.ResponseWriter, r *http.Request) {
+	h.writeSensor(w, r, "skytemperature", func(oc *weewx.ObservingConditions) *float64 { return oc.SkyTemperature })
 }
 
-func (h *Handler) GetTemperature(w http.ResponseWriter, r *http.Request) {
+// GetStarFWHM returns the latest measurement from imaging frames. Like the
+// other sensors, it needs the client to be connected.
+func (h *Handler) GetStarFWHM(w http.ResponseWriter, r *http.Request) {
 	ctx := alpaca.FromContext(r.Context())
 
-	oc := h.weewx.GetCurrent()
-	if oc == nil || oc.Temperature == nil {
-		writeResponse(r, w, http.StatusInternalServerError, &SimpleResponse{
-			TraceID: tracing.FromContext(r.Context()),
-			Message: "observing conditions is nil",
-		})
+	if !h.supports(r, "starfwhm") {
+		writeError(w, r, ErrNotImplemented)
 		return
 	}
 
-	writeResponse(r, w, http.StatusOK, &AlpacaFloatResponse{
-		AlpacaResponse: AlpacaResponse{
-			ClientTransactionID: ctx.ClientTransactionID,
-			ServerTransactionID: ctx.ServerTransactionID,
-		},
-		Value: *oc.Temperature,
-	})
-}
-
-func (h *Handler) GetWindDirection(w http.ResponseWriter, r *http.Request) {
-	ctx := alpaca.FromContext(r.Context())
+	if !h.clientConnected(r) {
+		writeError(w, r, ErrNotConnected)
+		return
+	}
 
-	oc := h.weewx.GetCurrent()
-	if oc == nil || oc.WindDirection == nil {
-		writeResponse(r, w, http.StatusInternalServerError, &SimpleResponse{
-			TraceID: tracing.FromContext(r.Context()),
-			Message: "observing conditions is nil",
-		})
+	starFWHM := h.fwhm.Current()
+	if starFWHM == nil {
+		writeError(w, r, ErrValueNotSet)
 		return
 	}
 
@@ -260,49 +177,71 @@ func (h *Handler) GetWindDirection(w http.ResponseWriter, r *http.Request) {
 			ClientTransactionID: ctx.ClientTransactionID,
 			ServerTransactionID: ctx.ServerTransactionID,
 		},
-		Value: *oc.WindDirection,
+		Value: *starFWHM,
 	})
 }
 
-func (h *Handler) GetWindGust(w http.ResponseWriter, r *http.Request) {
-	ctx := alpaca.FromContext(r.Context())
+func (h *Handler) GetTemperature(w http.ResponseWriter, r *http.Request) {
+	h.writeSensor(w, r, "temperature", func(oc *weewx.ObservingConditions) *float64 { return oc.Temperature })
+}
 
-	oc := h.weewx.GetCurrent()
-	if oc == nil || oc.WindGust == nil {
-		writeResponse(r, w, http.StatusInternalServerError, &SimpleResponse{
-			TraceID: tracing.FromContext(r.Context()),
-			Message: "observing conditions is nil",
-		})
-		return
-	}
+func (h *Handler) GetWindDirection(w http.ResponseWriter, r *http.Request) {
+	h.writeSensor(w, r, "winddirection", func(oc *weewx.ObservingConditions) *float64 { return oc.WindDirection })
+}
 
-	writeResponse(r, w, http.StatusOK, &AlpacaFloatResponse{
-		AlpacaResponse: AlpacaResponse{
-			ClientTransactionID: ctx.ClientTransactionID,
-			ServerTransactionID: ctx.ServerTransactionID,
-		},
-		Value: *oc.WindGust,
-	})
+func (h *Handler) GetWindGust(w http.ResponseWriter, r *http.Request) {
+	h.writeSensor(w, r, "windgust", func(oc *weewx.ObservingConditions) *float64 { return oc.WindGust })
 }
 
 func (h *Handler) GetWindSpeed(w http.ResponseWriter, r *http.Request) {
+	h.writeSensor(w, r, "windspeed", func(oc *weewx.ObservingConditions) *float64 { return oc.WindSpeed })
+}
+
+// GetDeviceState returns every available sensor value in one call, along with
+// the time the state was assembled.
+func (h *Handler) GetDeviceState(w http.ResponseWriter, r *http.Request) {
 	ctx := alpaca.FromContext(r.Context())
 
-	oc := h.weewx.GetCurrent()
-	if oc == nil || oc.WindSpeed == nil {
-		writeResponse(r, w, http.StatusInternalServerError, &SimpleResponse{
-			TraceID: tracing.FromContext(r.Context()),
-			Message: "observing conditions is nil",
-		})
+	state := []StateValue{}
+
+	add := func(name string, value *float64) {
+		if value != nil && h.supports(r, strings.ToLower(name)) {
+			state = append(state, StateValue{Name: name, Value: *value})
+		}
+	}
+
+	// Like the properties, the state is an error while disconnected.
+	oc, err := h.current(r)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	writeResponse(r, w, http.StatusOK, &AlpacaFloatResponse{
+	add("CloudCover", oc.CloudCover)
+	add("DewPoint", oc.DewPoint)
+	add("Humidity", oc.Humidity)
+	add("Pressure", oc.Pressure)
+	add("RainRate", oc.RainRate)
+	add("SkyBrightness", oc.SkyBrightness)
+	add("SkyQuality", oc.SkyQuality)
+	add("SkyTemperature", oc.SkyTemperature)
+	add("Temperature", oc.Temperature)
+	add("WindDirection", oc.WindDirection)
+	add("WindGust", oc.WindGust)
+	add("WindSpeed", oc.WindSpeed)
+
+	if h.supports(r, "starfwhm") {
+		add("StarFWHM", h.fwhm.Current())
+	}
+
+	state = append(state, StateValue{Name: "TimeStamp", Value: time.Now().UTC().Format(time.RFC3339Nano)})
+
+	writeResponse(r, w, http.StatusOK, &AlpacaDeviceStateResponse{
 		AlpacaResponse: AlpacaResponse{
 			ClientTransactionID: ctx.ClientTransactionID,
 			ServerTransactionID: ctx.ServerTransactionID,
 		},
-		Value: *oc.WindSpeed,
+		Value: state,
 	})
 }
 
@@ -315,136 +254,113 @@ func (h *Handler) PutRefresh(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) GetSensorDescription(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query()
-	var sensorName string
+	ctx := alpaca.FromContext(r.Context())
 
-	for k, vs := range query {
-		if strings.ToLower(k) == "sensorname" {
-			sensorName = vs[0]
-		}
+	sensorName, err := ctx.Params.String("SensorName")
+	if err != nil {
+		middleware.BadRequest(w, err.Error())
+		return
 	}
 
-	ctx := alpaca.FromContext(r.Context())
+	sensor := strings.ToLower(sensorName)
 
-	switch strings.ToLower(sensorName) {
-	case "cloudcover":
-		fallthrough
-	case "skybrightness":
-		fallthrough
-	case "skyquality":
-		fallthrough
-	case "skytemperature":
-		fallthrough
-	case "starfwhm":
-		errNumber := 0x400
-		errMessage := "Not implemented"
-		writeResponse(r, w, http.StatusOK, &AlpacaResponse{
-			ClientTransactionID: ctx.ClientTransactionID,
-			ServerTransactionID: ctx.ServerTransactionID,
-			ErrorNumber:         &errNumber,
-			ErrorMessage:        &errMessage,
-		})
+	if !isSensor(sensor) {
+		writeError(w, r, ErrInvalidValue)
 		return
 	}
 
-	switch strings.ToLower(sensorName) {
+	if !h.supports(r, sensor) {
+		writeError(w, r, ErrNotImplemented)
+		return
+	}
+
+	oc := h.device(r).Source.GetCurrent()
+	if oc == nil {
+		oc = &weewx.ObservingConditions{}
+	}
+
+	description := sensorName
+
+	switch sensor {
 	case "dewpoint":
-		fallthrough
+		if oc.DewPointDerived {
+			description = sensorName + " (derived from temperature and humidity)"
+		}
 	case "humidity":
-		fallthrough
-	case "pressure":
-		fallthrough
-	case "rainrate":
-		fallthrough
-	case "temperature":
-		fallthrough
-	case "winddirection":
-		fallthrough
-	case "windgust":
-		fallthrough
-	case "windspeed":
-		writeResponse(r, w, http.StatusOK, &AlpacaStringResponse{
-			AlpacaResponse: AlpacaResponse{
-				ClientTransactionID: ctx.ClientTransactionID,
-				ServerTransactionID: ctx.ServerTransactionID,
-			},
-			Value: sensorName,
-		})
-		return
+		if oc.HumidityDerived {
+			description = sensorName + " (derived from temperature and dew point)"
+		}
+	case "cloudcover":
+		description = sensorName + " (derived from sky and ambient temperature)"
+		if oc.CloudCoverFromCamera {
+			description = sensorName + " (estimated from all-sky camera star count)"
+		}
+	case "skybrightness":
+		description = sensorName + " (derived from sky quality)"
+	case "starfwhm":
+		description = sensorName + " (measured from imaging frames)"
 	}
 
-	writeResponse(r, w, http.StatusBadRequest, nil)
+	writeResponse(r, w, http.StatusOK, &AlpacaStringResponse{
+		AlpacaResponse: AlpacaResponse{
+			ClientTransactionID: ctx.ClientTransactionID,
+			ServerTransactionID: ctx.ServerTransactionID,
+		},
+		Value: description,
+	})
 }
 
+// GetTimeSinceLastUpdate returns the age of the named sensor's value. An empty
+// sensor name asks for the most recent update of any sensor.
 func (h *Handler) GetTimeSinceLastUpdate(w http.ResponseWriter, r *http.Request) {
 	ctx := alpaca.FromContext(r.Context())
 
-	query := r.URL.Query()
-	var sensorName string
+	sensorName, err := ctx.Params.String("SensorName")
+	if err != nil {
+		middleware.BadRequest(w, err.Error())
+		return
+	}
 
-	for k, vs := range query {
-		if strings.ToLower(k) == "sensorname" {
-			sensorName = vs[0]
-		}
+	sensor := strings.ToLower(sensorName)
+
+	if sensor != "" && !isSensor(sensor) {
+		writeError(w, r, ErrInvalidValue)
+		return
 	}
 
-	switch strings.ToLower(sensorName) {
-	case "cloudcover":
-		fallthrough
-	case "skybrightness":
-		fallthrough
-	case "skyquality":
-		fallthrough
-	case "skytemperature":
-		fallthrough
-	case "starfwhm":
-		errNumber := 0x400
-		errMessage := "Not implemented"
-		writeResponse(r, w, http.StatusOK, &AlpacaResponse{
-			ClientTransactionID: ctx.ClientTransactionID,
-			ServerTransactionID: ctx.ServerTransactionID,
-			ErrorNumber:         &errNumber,
-			ErrorMessage:        &errMessage,
-		})
+	if sensor != "" && !h.supports(r, sensor) {
+		writeError(w, r, ErrNotImplemented)
 		return
 	}
 
-	switch strings.ToLower(sensorName) {
-	case "":
-		fallthrough
-	case "dewpoint":
-		fallthrough
-	case "humidity":
-		fallthrough
-	case "pressure":
-		fallthrough
-	case "rainrate":
-		fallthrough
-	case "temperature":
-		fallthrough
-	case "winddirection":
-		fallthrough
-	case "windgust":
-		fallthrough
-	case "windspeed":
-		oc := h.weewx.GetCurrent()
-		if oc == nil {
-			writeResponse(r, w, http.StatusInternalServerError, &SimpleResponse{
-				TraceID: tracing.FromContext(r.Context()),
-				Message: "observing conditions is nil",
-			})
+	var lastUpdated time.Time
+
+	if sensor == "starfwhm" {
+		if !h.clientConnected(r) {
+			writeError(w, r, ErrNotConnected)
 			return
 		}
 
-		writeResponse(r, w, http.StatusOK, &AlpacaFloatResponse{
-			AlpacaResponse: AlpacaResponse{
-				ClientTransactionID: ctx.ClientTransactionID,
-				ServerTransactionID: ctx.ServerTransactionID,
-			},
-			Value: time.Since(oc.LastUpdated).Seconds(),
-		})
-		return
+		lastUpdated = h.fwhm.LastUpdated()
+		if lastUpdated.IsZero() {
+			writeError(w, r, ErrValueNotSet)
+			return
+		}
+	} else {
+		oc, err := h.current(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		lastUpdated = oc.LastUpdated
 	}
 
-	writeResponse(r, w, http.StatusBadRequest, nil)
+	writeResponse(r, w, http.StatusOK, &AlpacaFloatResponse{
+		AlpacaResponse: AlpacaResponse{
+			ClientTransactionID: ctx.ClientTransactionID,
+			ServerTransactionID: ctx.ServerTransactionID,
+		},
+		Value: time.Since(lastUpdated).Seconds(),
+	})
 }
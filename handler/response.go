@@ -57,14 +57,15 @@ type AlpacaBooleanResponse struct {
 	Value bool `json:"Value"`
 }
 
-type AlpacaRequest struct {
-	ClientID            uint64 `json:"ClientID"`
-	ClientTransactionID uint64 `json:"ClientTransactionID"`
+// StateValue is one property in a DeviceState response.
+type StateValue struct {
+	Name  string      `json:"Name"`
+	Value interface{} `json:"Value"`
 }
 
-type AlpacaConnectedRequest struct {
-	AlpacaRequest
-	Connected bool `json:"Connected"`
+type AlpacaDeviceStateResponse struct {
+	AlpacaResponse
+	Value []StateValue `json:"Value"`
 }
 
 func writeResponse(r *http.Request, w http.ResponseWriter, status int, resp interface{}) {
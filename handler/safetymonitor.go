@@ -0,0 +1,32 @@
+// Package handler implements the request handlers for the API.
+package handler
+
+import (
+	"net/http"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/alpaca"
+)
+
+// GetIsSafe reports unsafe to clients that have disconnected, as the Alpaca
+// specification requires.
+func (h *Handler) GetIsSafe(w http.ResponseWriter, r *http.Request) {
+	ctx := alpaca.FromContext(r.Context())
+
+	writeResponse(r, w, http.StatusOK, &AlpacaBooleanResponse{
+		AlpacaResponse: AlpacaResponse{
+			ClientTransactionID: ctx.ClientTransactionID,
+			ServerTransactionID: ctx.ServerTransactionID,
+		},
+		Value: h.clientConnected(r) && h.safety.IsSafe(),
+	})
+}
+
+// unsafeReasonsAction returns why the conditions are unsafe as a JSON array.
+func (h *Handler) unsafeReasonsAction(r *http.Request, parameters string) (string, error) {
+	reasons := h.safety.Reasons()
+	if reasons == nil {
+		reasons = []string{}
+	}
+
+	return marshalAction(reasons)
+}
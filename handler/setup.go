@@ -0,0 +1,427 @@
+// Package handler implements the request handlers for the API.
+package handler
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/logging"
+	"github.com/darkdragonsastro/weewx-json-alpaca/safety"
+	"github.com/darkdragonsastro/weewx-json-alpaca/weewx"
+)
+
+// Configurable is implemented by sources whose settings can be changed from
+// the setup pages.
+type Configurable interface {
+	Settings() weewx.Settings
+	Configure(s weewx.Settings) error
+}
+
+// field is an input on a setup form.
+type field struct {
+	Name  string
+	Label string
+	// Type is the input type: text, number, checkbox or duration.
+	Type string
+	Help string
+}
+
+var deviceFields = []field{
+	{Name: "url", Label: "WeeWX JSON URL", Type: "text"},
+	{Name: "interval", Label: "Poll interval", Type: "duration", Help: "such as 5s or 1m"},
+	{Name: "always_derive_dewpoint", Label: "Always derive dew point", Type: "checkbox", Help: "from temperature and humidity, even when the station reports it"},
+	{Name: "sky_temperature_field", Label: "Sky temperature field", Type: "text", Help: "WeeWX field name, empty when there is no IR sensor"},
+	{Name: "sky_quality_field", Label: "Sky quality field", Type: "text", Help: "WeeWX field name, empty when there is no SQM extension"},
+	{Name: "k1", Label: "Cloud model K1", Type: "number"},
+	{Name: "k2", Label: "Cloud model K2", Type: "number"},
+	{Name: "k3", Label: "Cloud model K3", Type: "number"},
+	{Name: "k4", Label: "Cloud model K4", Type: "number"},
+	{Name: "k5", Label: "Cloud model K5", Type: "number"},
+	{Name: "k6", Label: "Cloud model K6", Type: "number"},
+	{Name: "k7", Label: "Cloud model K7", Type: "number"},
+	{Name: "clear_threshold", Label: "Clear threshold (°C)", Type: "number", Help: "corrected sky temperature for 0% cloud cover"},
+	{Name: "overcast_threshold", Label: "Overcast threshold (°C)", Type: "number", Help: "corrected sky temperature for 100% cloud cover"},
+	{Name: "temperature_offset", Label: "Temperature offset (°C)", Type: "number", Help: "added to the station reading"},
+	{Name: "humidity_offset", Label: "Humidity offset (%)", Type: "number", Help: "added to the station reading"},
+	{Name: "pressure_offset", Label: "Pressure offset (hPa)", Type: "number", Help: "added to the station reading"},
+	{Name: "sky_temperature_offset", Label: "Sky temperature offset (°C)", Type: "number", Help: "added to the IR sensor reading"},
+	{Name: "sky_quality_offset", Label: "Sky quality offset (mag/arcsec²)", Type: "number", Help: "added to the SQM reading"},
+}
+
+var safetyFields = []field{
+	{Name: "wind_speed_max", Label: "Maximum wind speed (km/h)", Type: "number", Help: "0 disables the limit"},
+	{Name: "wind_speed_hysteresis", Label: "Wind speed hysteresis (km/h)", Type: "number"},
+	{Name: "wind_gust_max", Label: "Maximum wind gust (km/h)", Type: "number", Help: "0 disables the limit"},
+	{Name: "wind_gust_hysteresis", Label: "Wind gust hysteresis (km/h)", Type: "number"},
+	{Name: "humidity_max", Label: "Maximum humidity (%)", Type: "number", Help: "0 disables the limit"},
+	{Name: "humidity_hysteresis", Label: "Humidity hysteresis (%)", Type: "number"},
+	{Name: "cloud_cover_max", Label: "Maximum cloud cover (%)", Type: "number", Help: "0 disables the limit"},
+	{Name: "cloud_cover_hysteresis", Label: "Cloud cover hysteresis (%)", Type: "number"},
+	{Name: "unsafe_when_raining", Label: "Unsafe when raining", Type: "checkbox"},
+	{Name: "max_age", Label: "Maximum data age", Type: "duration", Help: "0s disables the check"},
+	{Name: "min_safe_time", Label: "Safe for at least", Type: "duration"},
+	{Name: "min_unsafe_time", Label: "Unsafe for at least", Type: "duration"},
+}
+
+// setupPage is the data the setup templates are rendered with.
+type setupPage struct {
+	Title   string
+	Devices []setupDevice
+	Fields  []field
+	Values  map[string]string
+	Errors  []string
+	Saved   bool
+	// Note explains why the settings are not editable or not persisted.
+	Note string
+}
+
+type setupDevice struct {
+	Name string
+	URL  string
+}
+
+var setupTemplate = template.Must(template.New("setup").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 2em auto; }
+label { display: block; margin-top: 1em; font-weight: bold; }
+small { display: block; color: #666; }
+input[type=text], input[type=number] { width: 100%; }
+.errors { color: #b00; }
+.saved { color: #070; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Saved}}<p class="saved">Settings saved and applied.</p>{{end}}
+{{if .Errors}}<ul class="errors">{{range .Errors}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{if .Note}}<p>{{.Note}}</p>{{end}}
+{{if .Devices}}<ul>{{range .Devices}}<li><a href="{{.URL}}">{{.Name}}</a></li>{{end}}</ul>{{end}}
+{{if .Fields}}
+<form method="post">
+{{$values := .Values}}
+{{range .Fields}}
+<label for="{{.Name}}">{{.Label}}</label>
+{{if eq .Type "checkbox"}}<input type="checkbox" id="{{.Name}}" name="{{.Name}}" value="true"{{if eq (index $values .Name) "true"}} checked{{end}}>
+{{else if eq .Type "number"}}<input type="number" step="any" id="{{.Name}}" name="{{.Name}}" value="{{index $values .Name}}">
+{{else}}<input type="text" id="{{.Name}}" name="{{.Name}}" value="{{index $values .Name}}">
+{{end}}
+{{if .Help}}<small>{{.Help}}</small>{{end}}
+{{end}}
+<p><button type="submit">Save</button> <a href="/setup">Back</a></p>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+func writeSetupPage(w http.ResponseWriter, r *http.Request, status int, page *setupPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	err := setupTemplate.Execute(w, page)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("error writing setup page", zap.Error(err))
+	}
+}
+
+// Setup lists the devices that have setup pages.
+func (h *Handler) Setup(w http.ResponseWriter, r *http.Request) {
+	page := &setupPage{
+		Title: h.identity.ServerName + " setup",
+	}
+
+	for i, d := range h.devices {
+		page.Devices = append(page.Devices, setupDevice{
+			Name: d.Name,
+			URL:  fmt.Sprintf("/setup/v1/observingconditions/%d/setup", i),
+		})
+	}
+
+	page.Devices = append(page.Devices, setupDevice{
+		Name: "Safety monitor",
+		URL:  "/setup/v1/safetymonitor/0/setup",
+	})
+
+	writeSetupPage(w, r, http.StatusOK, page)
+}
+
+// GetDeviceSetup shows the settings of an ObservingConditions device.
+func (h *Handler) GetDeviceSetup(w http.ResponseWriter, r *http.Request) {
+	d := h.device(r)
+
+	page := &setupPage{
+		Title: d.Name + " setup",
+		Saved: r.URL.Query().Get("saved") == "true",
+	}
+
+	c, ok := d.Source.(Configurable)
+	if !ok {
+		page.Note = "This device takes its settings from another device and has none of its own."
+		writeSetupPage(w, r, http.StatusOK, page)
+		return
+	}
+
+	page.Fields = deviceFields
+	page.Values = deviceValues(c.Settings())
+	page.Note = h.persistenceNote()
+
+	writeSetupPage(w, r, http.StatusOK, page)
+}
+
+// PostDeviceSetup validates the submitted settings of an ObservingConditions
+// device, applies them and saves them.
+func (h *Handler) PostDeviceSetup(w http.ResponseWriter, r *http.Request) {
+	d := h.device(r)
+
+	c, ok := d.Source.(Configurable)
+	if !ok {
+		h.GetDeviceSetup(w, r)
+		return
+	}
+
+	page := &setupPage{
+		Title:  d.Name + " setup",
+		Fields: deviceFields,
+		Values: formValues(r.PostForm, deviceFields),
+	}
+
+	s, errs := parseDeviceForm(r.PostForm)
+	if len(errs) == 0 {
+		err := c.Configure(s)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		page.Errors = errs
+		writeSetupPage(w, r, http.StatusBadRequest, page)
+		return
+	}
+
+	if h.settings != nil {
+		err := h.settings.SetDevice(d.UniqueID, s)
+		if err != nil {
+			page.Errors = []string{"The settings were applied but could not be saved: " + err.Error()}
+			writeSetupPage(w, r, http.StatusInternalServerError, page)
+			return
+		}
+	}
+
+	http.Redirect(w, r, r.URL.Path+"?saved=true", http.StatusSeeOther)
+}
+
+// GetSafetySetup shows the safety monitor rules.
+func (h *Handler) GetSafetySetup(w http.ResponseWriter, r *http.Request) {
+	writeSetupPage(w, r, http.StatusOK, &setupPage{
+		Title:  "Safety monitor setup",
+		Fields: safetyFields,
+		Values: safetyValues(h.safety.Rules()),
+		Saved:  r.URL.Query().Get("saved") == "true",
+		Note:   h.persistenceNote(),
+	})
+}
+
+// PostSafetySetup validates the submitted safety rules, applies them and
+// saves them.
+func (h *Handler) PostSafetySetup(w http.ResponseWriter, r *http.Request) {
+	page := &setupPage{
+		Title:  "Safety monitor setup",
+		Fields: safetyFields,
+		Values: formValues(r.PostForm, safetyFields),
+	}
+
+	rules, errs := parseSafetyForm(r.PostForm)
+	if len(errs) == 0 {
+		err := h.safety.SetRules(rules)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		page.Errors = errs
+		writeSetupPage(w, r, http.StatusBadRequest, page)
+		return
+	}
+
+	if h.settings != nil {
+		err := h.settings.SetSafety(rules)
+		if err != nil {
+			page.Errors = []string{"The settings were applied but could not be saved: " + err.Error()}
+			writeSetupPage(w, r, http.StatusInternalServerError, page)
+			return
+		}
+	}
+
+	http.Redirect(w, r, r.URL.Path+"?saved=true", http.StatusSeeOther)
+}
+
+func (h *Handler) persistenceNote() string {
+	if h.settings == nil {
+		return "Changes are applied but not saved, and are lost on restart."
+	}
+
+	return "Changes are applied immediately and saved to " + h.settings.Path() + "."
+}
+
+// formValues returns the submitted values of the fields, so that the form
+// can be shown again as it was entered.
+func formValues(form url.Values, fields []field) map[string]string {
+	values := make(map[string]string, len(fields))
+	for _, f := range fields {
+		values[f.Name] = form.Get(f.Name)
+	}
+
+	return values
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func deviceValues(s weewx.Settings) map[string]string {
+	return map[string]string{
+		"url":                    s.URL,
+		"interval":               s.Interval.String(),
+		"always_derive_dewpoint": strconv.FormatBool(s.AlwaysDeriveDewPoint),
+		"sky_temperature_field":  s.SkyTemperatureField,
+		"sky_quality_field":      s.SkyQualityField,
+		"k1":                     formatFloat(s.CloudModel.K1),
+		"k2":                     formatFloat(s.CloudModel.K2),
+		"k3":                     formatFloat(s.CloudModel.K3),
+		"k4":                     formatFloat(s.CloudModel.K4),
+		"k5":                     formatFloat(s.CloudModel.K5),
+		"k6":                     formatFloat(s.CloudModel.K6),
+		"k7":                     formatFloat(s.CloudModel.K7),
+		"clear_threshold":        formatFloat(s.CloudModel.ClearThreshold),
+		"overcast_threshold":     formatFloat(s.CloudModel.OvercastThreshold),
+		"temperature_offset":     formatFloat(s.Calibration.Temperature),
+		"humidity_offset":        formatFloat(s.Calibration.Humidity),
+		"pressure_offset":        formatFloat(s.Calibration.Pressure),
+		"sky_temperature_offset": formatFloat(s.Calibration.SkyTemperature),
+		"sky_quality_offset":     formatFloat(s.Calibration.SkyQuality),
+	}
+}
+
+func safetyValues(rules safety.Rules) map[string]string {
+	return map[string]string{
+		"wind_speed_max":         formatFloat(rules.WindSpeed.Max),
+		"wind_speed_hysteresis":  formatFloat(rules.WindSpeed.Hysteresis),
+		"wind_gust_max":          formatFloat(rules.WindGust.Max),
+		"wind_gust_hysteresis":   formatFloat(rules.WindGust.Hysteresis),
+		"humidity_max":           formatFloat(rules.Humidity.Max),
+		"humidity_hysteresis":    formatFloat(rules.Humidity.Hysteresis),
+		"cloud_cover_max":        formatFloat(rules.CloudCover.Max),
+		"cloud_cover_hysteresis": formatFloat(rules.CloudCover.Hysteresis),
+		"unsafe_when_raining":    strconv.FormatBool(rules.UnsafeWhenRaining),
+		"max_age":                rules.MaxAge.String(),
+		"min_safe_time":          rules.MinSafeTime.String(),
+		"min_unsafe_time":        rules.MinUnsafeTime.String(),
+	}
+}
+
+// formParser reads typed values from a submitted form, collecting an error
+// for each field that does not parse.
+type formParser struct {
+	form   url.Values
+	fields []field
+	errs   []string
+}
+
+func (p *formParser) label(name string) string {
+	for _, f := range p.fields {
+		if f.Name == name {
+			return f.Label
+		}
+	}
+
+	return name
+}
+
+func (p *formParser) string(name string) string {
+	return strings.TrimSpace(p.form.Get(name))
+}
+
+func (p *formParser) bool(name string) bool {
+	return p.form.Get(name) == "true"
+}
+
+func (p *formParser) float(name string) float64 {
+	f, err := strconv.ParseFloat(p.string(name), 64)
+	if err != nil {
+		p.errs = append(p.errs, p.label(name)+" must be a number")
+	}
+
+	return f
+}
+
+func (p *formParser) duration(name string) time.Duration {
+	d, err := time.ParseDuration(p.string(name))
+	if err != nil {
+		p.errs = append(p.errs, p.label(name)+" must be a duration such as 30s or 5m")
+	}
+
+	return d
+}
+
+func parseDeviceForm(form url.Values) (weewx.Settings, []string) {
+	p := &formParser{form: form, fields: deviceFields}
+
+	s := weewx.Settings{
+		URL:                  p.string("url"),
+		Interval:             p.duration("interval"),
+		AlwaysDeriveDewPoint: p.bool("always_derive_dewpoint"),
+		SkyTemperatureField:  p.string("sky_temperature_field"),
+		SkyQualityField:      p.string("sky_quality_field"),
+		CloudModel: weewx.CloudModel{
+			K1:                p.float("k1"),
+			K2:                p.float("k2"),
+			K3:                p.float("k3"),
+			K4:                p.float("k4"),
+			K5:                p.float("k5"),
+			K6:                p.float("k6"),
+			K7:                p.float("k7"),
+			ClearThreshold:    p.float("clear_threshold"),
+			OvercastThreshold: p.float("overcast_threshold"),
+		},
+		Calibration: weewx.Calibration{
+			Temperature:    p.float("temperature_offset"),
+			Humidity:       p.float("humidity_offset"),
+			Pressure:       p.float("pressure_offset"),
+			SkyTemperature: p.float("sky_temperature_offset"),
+			SkyQuality:     p.float("sky_quality_offset"),
+		},
+	}
+
+	return s, p.errs
+}
+
+func parseSafetyForm(form url.Values) (safety.Rules, []string) {
+	p := &formParser{form: form, fields: safetyFields}
+
+	rules := safety.Rules{
+		WindSpeed:         safety.Limit{Max: p.float("wind_speed_max"), Hysteresis: p.float("wind_speed_hysteresis")},
+		WindGust:          safety.Limit{Max: p.float("wind_gust_max"), Hysteresis: p.float("wind_gust_hysteresis")},
+		Humidity:          safety.Limit{Max: p.float("humidity_max"), Hysteresis: p.float("humidity_hysteresis")},
+		CloudCover:        safety.Limit{Max: p.float("cloud_cover_max"), Hysteresis: p.float("cloud_cover_hysteresis")},
+		UnsafeWhenRaining: p.bool("unsafe_when_raining"),
+		MaxAge:            p.duration("max_age"),
+		MinSafeTime:       p.duration("min_safe_time"),
+		MinUnsafeTime:     p.duration("min_unsafe_time"),
+	}
+
+	return rules, p.errs
+}
@@ -0,0 +1,67 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSetupRejectsCrossOriginPosts(t *testing.T) {
+	srv := newFakeServer(t)
+
+	form := url.Values{
+		"wind_speed_max":         {"40"},
+		"wind_speed_hysteresis":  {"5"},
+		"wind_gust_max":          {"0"},
+		"wind_gust_hysteresis":   {"0"},
+		"humidity_max":           {"90"},
+		"humidity_hysteresis":    {"3"},
+		"cloud_cover_max":        {"0"},
+		"cloud_cover_hysteresis": {"0"},
+		"max_age":                {"5m"},
+		"min_safe_time":          {"10m"},
+		"min_unsafe_time":        {"0s"},
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	for _, tt := range []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"same origin", "Origin", srv.URL, http.StatusSeeOther},
+		{"same referer", "Referer", srv.URL + "/setup/v1/safetymonitor/0/setup", http.StatusSeeOther},
+		{"no origin", "", "", http.StatusSeeOther},
+		{"other origin", "Origin", "http://example.com", http.StatusForbidden},
+		{"other referer", "Referer", "http://example.com/page", http.StatusForbidden},
+		{"null origin", "Origin", "null", http.StatusForbidden},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, srv.URL+"/setup/v1/safetymonitor/0/setup", strings.NewReader(form.Encode()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != tt.want {
+				t.Errorf("status %d, want %d", res.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+// Package handler implements the request handlers for the API.
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/alpaca"
+	"github.com/darkdragonsastro/weewx-json-alpaca/middleware"
+	"github.com/darkdragonsastro/weewx-json-alpaca/switches"
+)
+
+func (h *Handler) GetMaxSwitch(w http.ResponseWriter, r *http.Request) {
+	ctx := alpaca.FromContext(r.Context())
+
+	writeResponse(r, w, http.StatusOK, &AlpacaIntResponse{
+		AlpacaResponse: AlpacaResponse{
+			ClientTransactionID: ctx.ClientTransactionID,
+			ServerTransactionID: ctx.ServerTransactionID,
+		},
+		Value: len(h.switches),
+	})
+}
+
+func (h *Handler) GetCanWrite(w http.ResponseWriter, r *http.Request) {
+	ctx := alpaca.FromContext(r.Context())
+
+	_, ok := h.findSwitch(w, r)
+	if !ok {
+		return
+	}
+
+	writeResponse(r, w, http.StatusOK, &AlpacaBooleanResponse{
+		AlpacaResponse: AlpacaResponse{
+			ClientTransactionID: ctx.ClientTransactionID,
+			ServerTransactionID: ctx.ServerTransactionID,
+		},
+		Value: false,
+	})
+}
+
+func (h *Handler) GetSwitch(w http.ResponseWriter, r *http.Request) {
+	ctx := alpaca.FromContext(r.Context())
+
+	s, ok := h.findSwitch(w, r)
+	if !ok {
+		return
+	}
+
+	value, ok := h.switchValue(w, r, s)
+	if !ok {
+		return
+	}
+
+	writeResponse(r, w, http.StatusOK, &AlpacaBooleanResponse{
+		AlpacaResponse: AlpacaResponse{
+			ClientTransactionID: ctx.ClientTransactionID,
+			ServerTransactionID: ctx.ServerTransactionID,
+		},
+		Value: value > s.Min,
+	})
+}
+
+func (h *Handler) GetSwitchValue(w http.ResponseWriter, r *http.Request) {
+	ctx := alpaca.FromContext(r.Context())
+
+	s, ok := h.findSwitch(w, r)
+	if !ok {
+		return
+	}
+
+	value, ok := h.switchValue(w, r, s)
+	if !ok {
+		return
+	}
+
+	writeResponse(r, w, http.StatusOK, &AlpacaFloatResponse{
+		AlpacaResponse: AlpacaResponse{
+			ClientTransactionID: ctx.ClientTransactionID,
+			ServerTransactionID: ctx.ServerTransactionID,
+		},
+		Value: value,
+	})
+}
+
+func (h *Handler) GetSwitchName(w http.ResponseWriter, r *http.Request) {
+	ctx := alpaca.FromContext(r.Context())
+
+	s, ok := h.findSwitch(w, r)
+	if !ok {
+		return
+	}
+
+	writeResponse(r, w, http.StatusOK, &AlpacaStringResponse{
+		AlpacaResponse: AlpacaResponse{
+			ClientTransactionID: ctx.ClientTransactionID,
+			ServerTransactionID: ctx.ServerTransactionID,
+		},
+		Value: s.Name,
+	})
+}
+
+func (h *Handler) GetSwitchDescription(w http.ResponseWriter, r *http.Request) {
+	ctx := alpaca.FromContext(r.Context())
+
+	s, ok := h.findSwitch(w, r)
+	if !ok {
+		return
+	}
+
+	writeResponse(r, w, http.StatusOK, &AlpacaStringResponse{
+		AlpacaResponse: AlpacaResponse{
+			ClientTransactionID: ctx.ClientTransactionID,
+			ServerTransactionID: ctx.ServerTransactionID,
+		},
+		Value: s.Description,
+	})
+}
+
+func (h *Handler) GetMinSwitchValue(w http.ResponseWriter, r *http.Request) {
+	h.writeSwitchLimit(w, r, func(s *switches.Switch) float64 { return s.Min })
+}
+
+func (h *Handler) GetMaxSwitchValue(w http.ResponseWriter, r *http.Request) {
+	h.writeSwitchLimit(w, r, func(s *switches.Switch) float64 { return s.Max })
+}
+
+func (h *Handler) GetSwitchStep(w http.ResponseWriter, r *http.Request) {
+	h.writeSwitchLimit(w, r, func(s *switches.Switch) float64 { return s.Step })
+}
+
+// PutSetSwitch is not implemented, since all switches are read-only.
+func (h *Handler) PutSetSwitch(w http.ResponseWriter, r *http.Request) {
+	h.writeReadOnlySwitch(w, r)
+}
+
+// PutSetSwitchName is not implemented, since all switches are read-only.
+func (h *Handler) PutSetSwitchName(w http.ResponseWriter, r *http.Request) {
+	h.writeReadOnlySwitch(w, r)
+}
+
+// PutSetSwitchValue is not implemented, since all switches are read-only.
+func (h *Handler) PutSetSwitchValue(w http.ResponseWriter, r *http.Request) {
+	h.writeReadOnlySwitch(w, r)
+}
+
+func (h *Handler) writeReadOnlySwitch(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, ErrNotImplemented)
+}
+
+func (h *Handler) writeSwitchLimit(w http.ResponseWriter, r *http.Request, limit func(s *switches.Switch) float64) {
+	ctx := alpaca.FromContext(r.Context())
+
+	s, ok := h.findSwitch(w, r)
+	if !ok {
+		return
+	}
+
+	writeResponse(r, w, http.StatusOK, &AlpacaFloatResponse{
+		AlpacaResponse: AlpacaResponse{
+			ClientTransactionID: ctx.ClientTransactionID,
+			ServerTransactionID: ctx.ServerTransactionID,
+		},
+		Value: limit(s),
+	})
+}
+
+// findSwitch returns the switch selected by the Id parameter. If there is no
+// such switch, it writes the error response and returns false.
+func (h *Handler) findSwitch(w http.ResponseWriter, r *http.Request) (*switches.Switch, bool) {
+	ctx := alpaca.FromContext(r.Context())
+
+	id, err := ctx.Params.Int("Id")
+	if err != nil {
+		middleware.BadRequest(w, err.Error())
+		return nil, false
+	}
+
+	if id < 0 || id >= len(h.switches) {
+		writeError(w, r, ErrInvalidValue)
+		return nil, false
+	}
+
+	return &h.switches[id], true
+}
+
+// switchValue returns the current value of the switch. If the conditions it
+// depends on are not available, it writes the error response and returns
+// false.
+func (h *Handler) switchValue(w http.ResponseWriter, r *http.Request, s *switches.Switch) (float64, bool) {
+	oc, err := h.current(r)
+	if err != nil {
+		writeError(w, r, err)
+		return 0, false
+	}
+
+	value := s.Value(oc, time.Now())
+	if value == nil {
+		writeError(w, r, ErrValueNotSet)
+		return 0, false
+	}
+
+	return *value, true
+}
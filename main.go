@@ -1,28 +1,150 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 
+	"github.com/darkdragonsastro/weewx-json-alpaca/allsky"
 	"github.com/darkdragonsastro/weewx-json-alpaca/alpaca"
 	"github.com/darkdragonsastro/weewx-json-alpaca/env"
+	"github.com/darkdragonsastro/weewx-json-alpaca/fwhm"
 	"github.com/darkdragonsastro/weewx-json-alpaca/handler"
 	"github.com/darkdragonsastro/weewx-json-alpaca/logging"
 	"github.com/darkdragonsastro/weewx-json-alpaca/router"
+	"github.com/darkdragonsastro/weewx-json-alpaca/safety"
 	"github.com/darkdragonsastro/weewx-json-alpaca/server"
+	"github.com/darkdragonsastro/weewx-json-alpaca/settings"
+	"github.com/darkdragonsastro/weewx-json-alpaca/sqm"
+	"github.com/darkdragonsastro/weewx-json-alpaca/stars"
+	"github.com/darkdragonsastro/weewx-json-alpaca/switches"
 	"github.com/darkdragonsastro/weewx-json-alpaca/weewx"
 )
 
+// config is read from the environment and, when CONFIG_FILE names one, a YAML
+// file whose keys are the variable names in lower case. The environment takes
+// precedence over the file.
 type config struct {
 	env.Config
+
+	// ConfigFile is watched and reloaded when it changes, checking it every
+	// ConfigWatchInterval, or on SIGHUP.
+	ConfigFile          string        `env:"CONFIG_FILE"`
+	ConfigWatchInterval time.Duration `env:"CONFIG_WATCH_INTERVAL" envDefault:"2s"`
+
 	ListenIPAddress string `env:"LISTEN_IP,required"`
 	ListenPort      int    `env:"LISTEN_PORT,required"`
 	WeeWxURL        string `env:"WEEWX_URL,required"`
+
+	// DiscoveryPort is the UDP port to answer Alpaca discovery probes on. Zero
+	// disables discovery.
+	DiscoveryPort int `env:"DISCOVERY_PORT" envDefault:"32227"`
+
+	AlwaysDeriveDewPoint bool `env:"ALWAYS_DERIVE_DEWPOINT"`
+
+	// Calibration offsets added to the readings of the first device.
+	CalibrationTemperature    float64 `env:"CALIBRATION_TEMPERATURE"`
+	CalibrationHumidity       float64 `env:"CALIBRATION_HUMIDITY"`
+	CalibrationPressure       float64 `env:"CALIBRATION_PRESSURE"`
+	CalibrationSkyTemperature float64 `env:"CALIBRATION_SKY_TEMPERATURE"`
+	CalibrationSkyQuality     float64 `env:"CALIBRATION_SKY_QUALITY"`
+
+	// The identity of the server and its devices. The location defaults to
+	// the station location reported by WeeWX.
+	ServerName        string `env:"SERVER_NAME" envDefault:"weewx-json-alpaca"`
+	Manufacturer      string `env:"MANUFACTURER" envDefault:"darkdragons"`
+	Location          string `env:"LOCATION"`
+	DeviceName        string `env:"DEVICE_NAME" envDefault:"weewx-json-alpaca"`
+	SafetyMonitorName string `env:"SAFETY_MONITOR_NAME" envDefault:"weewx-json-alpaca safety monitor"`
+	SwitchName        string `env:"SWITCH_NAME" envDefault:"weewx-json-alpaca switch"`
+
+	// ExtraDevices is a JSON array of additional ObservingConditions devices.
+	ExtraDevices deviceConfigs `env:"EXTRA_DEVICES"`
+
+	// RemoteURL is another Alpaca server, such as ASCOM Remote, with an
+	// ObservingConditions device to merge with the first device, to serve
+	// instead of WeeWX, or to serve as a device of its own.
+	RemoteURL          string        `env:"REMOTE_URL"`
+	RemoteDeviceNumber int           `env:"REMOTE_DEVICE_NUMBER" envDefault:"0"`
+	RemoteMode         string        `env:"REMOTE_MODE" envDefault:"merge"`
+	RemoteInterval     time.Duration `env:"REMOTE_INTERVAL" envDefault:"10s"`
+	RemoteDeviceName   string        `env:"REMOTE_DEVICE_NAME" envDefault:"Remote conditions"`
+
+	InteriorDevice     bool   `env:"INTERIOR_DEVICE"`
+	InteriorDeviceName string `env:"INTERIOR_DEVICE_NAME" envDefault:"Observatory interior"`
+
+	SkyTemperatureField    string  `env:"SKY_TEMPERATURE_FIELD"`
+	CloudK1                float64 `env:"CLOUD_K1" envDefault:"33"`
+	CloudK2                float64 `env:"CLOUD_K2" envDefault:"0"`
+	CloudK3                float64 `env:"CLOUD_K3" envDefault:"4"`
+	CloudK4                float64 `env:"CLOUD_K4" envDefault:"100"`
+	CloudK5                float64 `env:"CLOUD_K5" envDefault:"100"`
+	CloudK6                float64 `env:"CLOUD_K6" envDefault:"0"`
+	CloudK7                float64 `env:"CLOUD_K7" envDefault:"0"`
+	CloudClearThreshold    float64 `env:"CLOUD_CLEAR_THRESHOLD" envDefault:"-15"`
+	CloudOvercastThreshold float64 `env:"CLOUD_OVERCAST_THRESHOLD" envDefault:"0"`
+
+	SkyQualityField string `env:"SKY_QUALITY_FIELD"`
+	SQMAddress      string `env:"SQM_ADDRESS"`
+
+	FWHMAPIKey        string        `env:"FWHM_API_KEY"`
+	FWHMMode          string        `env:"FWHM_MODE" envDefault:"latest"`
+	FWHMAverageWindow time.Duration `env:"FWHM_AVERAGE_WINDOW" envDefault:"10m"`
+	FWHMMaxAge        time.Duration `env:"FWHM_MAX_AGE" envDefault:"30m"`
+
+	FWHMWatchDir           string        `env:"FWHM_WATCH_DIR"`
+	FWHMWatchInterval      time.Duration `env:"FWHM_WATCH_INTERVAL" envDefault:"5s"`
+	FWHMPixelScale         float64       `env:"FWHM_PIXEL_SCALE"`
+	FWHMDetectionThreshold float64       `env:"FWHM_DETECTION_THRESHOLD" envDefault:"5"`
+
+	AllSkyDir                string        `env:"ALLSKY_DIR"`
+	AllSkyMask               string        `env:"ALLSKY_MASK"`
+	AllSkyDetectionThreshold float64       `env:"ALLSKY_DETECTION_THRESHOLD" envDefault:"5"`
+	AllSkyZenithRadius       float64       `env:"ALLSKY_ZENITH_RADIUS" envDefault:"0.5"`
+	AllSkyExpectedStars      int           `env:"ALLSKY_EXPECTED_STARS" envDefault:"100"`
+	AllSkyInterval           time.Duration `env:"ALLSKY_INTERVAL" envDefault:"10s"`
+	AllSkyMaxAge             time.Duration `env:"ALLSKY_MAX_AGE" envDefault:"5m"`
+
+	SafetyMaxWindSpeed         float64       `env:"SAFETY_MAX_WIND_SPEED"`
+	SafetyWindSpeedHysteresis  float64       `env:"SAFETY_WIND_SPEED_HYSTERESIS"`
+	SafetyMaxWindGust          float64       `env:"SAFETY_MAX_WIND_GUST"`
+	SafetyWindGustHysteresis   float64       `env:"SAFETY_WIND_GUST_HYSTERESIS"`
+	SafetyMaxHumidity          float64       `env:"SAFETY_MAX_HUMIDITY"`
+	SafetyHumidityHysteresis   float64       `env:"SAFETY_HUMIDITY_HYSTERESIS"`
+	SafetyMaxCloudCover        float64       `env:"SAFETY_MAX_CLOUD_COVER"`
+	SafetyCloudCoverHysteresis float64       `env:"SAFETY_CLOUD_COVER_HYSTERESIS"`
+	SafetyUnsafeWhenRaining    bool          `env:"SAFETY_UNSAFE_WHEN_RAINING" envDefault:"true"`
+	SafetyMaxAge               time.Duration `env:"SAFETY_MAX_AGE" envDefault:"5m"`
+	SafetyMinSafeTime          time.Duration `env:"SAFETY_MIN_SAFE_TIME" envDefault:"10m"`
+	SafetyMinUnsafeTime        time.Duration `env:"SAFETY_MIN_UNSAFE_TIME" envDefault:"0s"`
+
+	// MDNS advertises the Alpaca API and setup pages over mDNS as MDNSName.
+	// The name defaults to one including the host name.
+	MDNS     bool   `env:"MDNS" envDefault:"true"`
+	MDNSName string `env:"MDNS_NAME"`
+
+	// ShutdownTimeout bounds the time to finish requests in flight, and then
+	// the time to stop everything else.
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"30s"`
+
+	// AdminAPIKey must be sent in the X-Api-Key header to list the clients
+	// at /admin/clients, which is not served without one.
+	AdminAPIKey string `env:"ADMIN_API_KEY"`
+
+	// StateDir holds the settings changed from the setup pages.
+	StateDir string `env:"STATE_DIR" envDefault:"."`
+
+	SwitchConditions string `env:"SWITCH_CONDITIONS" envDefault:"Raining:rainrate>0;Windy:windgust>40;Dew risk:dewpointdepression<2;Data stale:age>300"`
+	SwitchAnalog     string `env:"SWITCH_ANALOG" envDefault:"temperature,humidity,dewpoint,pressure,windspeed,windgust"`
 }
 
 func main() {
@@ -35,41 +157,260 @@ func main() {
 		}
 	}()
 
+	if len(os.Args) > 1 && os.Args[1] == "sqm-simulator" {
+		log := logging.Initialize(env.Config{})
+
+		err = runSQMSimulator(log, os.Args[2:])
+		if err != nil {
+			log.Error("error running sqm simulator", zap.Error(err))
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "fits-fwhm" {
+		err = runFITSFWHM(os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		err = runSelfTest(os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "validate-config" {
+		err = runValidateConfig(os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "discover" {
+		err = runDiscover(os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return
+	}
+
+	configFile := os.Getenv("CONFIG_FILE")
+
 	var c config
-	err = env.Load(&c)
+	c, err = loadConfig(configFile)
 	log := logging.Initialize(c.Config)
 
 	if err != nil {
-		log.Error("error initializing environment", zap.Error(err))
+		log.Error("error loading configuration", zap.String("file", configFile), zap.Error(err))
 		return
 	}
 
 	log.Info("initializing")
 
-	discovery := alpaca.NewAlpacaDiscovery(log, c.ListenPort)
+	// ctx is done on SIGINT or SIGTERM, which shuts the server down.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	sup := newSupervisor(log, c.ShutdownTimeout)
+	defer func() {
+		shutdownErr := sup.shutdown()
+		if shutdownErr != nil {
+			log.Error("error shutting down", zap.Error(shutdownErr))
+			if err == nil {
+				err = shutdownErr
+			}
+		}
+
+		log.Info("exiting")
+	}()
+
+	var sw []switches.Switch
+	sw, err = switches.Parse(c.SwitchConditions, c.SwitchAnalog)
+	if err != nil {
+		log.Error("error parsing switches", zap.Error(err))
+		return
+	}
+
+	var fwhmStore *fwhm.Store
+	if c.FWHMAPIKey != "" || c.FWHMWatchDir != "" {
+		var mode fwhm.Mode
+		mode, err = fwhm.ParseMode(c.FWHMMode)
+		if err != nil {
+			log.Error("error initializing fwhm store", zap.Error(err))
+			return
+		}
+
+		fwhmStore = fwhm.NewStore(mode, c.FWHMAverageWindow, c.FWHMMaxAge)
+	}
+
+	var discovery *alpaca.AlpacaDiscovery
+	if c.DiscoveryPort != 0 {
+		discovery = alpaca.NewAlpacaDiscovery(log, c.ListenPort, c.DiscoveryPort)
+
+		err = discovery.StartDiscovery()
+		if err != nil {
+			log.Error("error starting discovery", zap.Error(err))
+			return
+		}
+
+		sup.started("discovery", discovery.StopDiscovery)
+	}
+
+	var meter weewx.SkyQualityMeter
+	if c.SQMAddress != "" {
+		meter = sqm.NewClient(c.SQMAddress)
+	}
+
+	var watcher *fwhm.Watcher
+	if c.FWHMWatchDir != "" {
+		starOpts := stars.DefaultOptions()
+		starOpts.Threshold = c.FWHMDetectionThreshold
+
+		watcher = fwhm.NewWatcher(fwhmStore, fwhm.WatcherOptions{
+			Dir:        c.FWHMWatchDir,
+			PixelScale: c.FWHMPixelScale,
+			Interval:   c.FWHMWatchInterval,
+			Stars:      starOpts,
+		}, log)
+
+		err = watcher.Start()
+		if err != nil {
+			log.Error("error starting fits watcher", zap.Error(err))
+			return
+		}
+
+		sup.started("fits watcher", watcher.Stop)
+	}
+
+	var camera *allsky.Camera
+	var skyCamera weewx.SkyCamera
+	if c.AllSkyDir != "" {
+		var analyzer *allsky.Analyzer
+		analyzer, err = allsky.NewAnalyzer(allsky.Options{
+			MaskPath:      c.AllSkyMask,
+			Threshold:     c.AllSkyDetectionThreshold,
+			ZenithRadius:  c.AllSkyZenithRadius,
+			ExpectedStars: c.AllSkyExpectedStars,
+		})
+		if err != nil {
+			log.Error("error initializing all-sky analyzer", zap.Error(err))
+			return
+		}
 
-	discovery.StartDiscovery()
+		camera = allsky.NewCamera(analyzer, c.AllSkyDir, c.AllSkyInterval, c.AllSkyMaxAge, log)
 
-	client := weewx.NewClient(c.WeeWxURL, log)
-	client.Start()
+		err = camera.Start()
+		if err != nil {
+			log.Error("error starting all-sky camera", zap.Error(err))
+			return
+		}
 
-	h := handler.New(client)
+		sup.started("all-sky camera", camera.Stop)
 
-	r := router.NewRouter(h, log)
+		skyCamera = camera
+	}
 
-	err = startHTTPServer(r, log, fmt.Sprintf("%s:%d", c.ListenIPAddress, c.ListenPort))
+	var store *settings.Store
+	store, err = settings.Load(filepath.Join(c.StateDir, "settings.json"))
 	if err != nil {
-		log.Error("error starting server", zap.Error(err))
+		log.Error("error loading settings", zap.Error(err))
 		return
 	}
 
-	discovery.StopDiscovery()
-	client.Stop()
+	var id uuid.UUID
+	id, err = store.ID()
+	if err != nil {
+		log.Error("error getting server id", zap.Error(err))
+		return
+	}
+
+	devices, sources := newDevices(c, id, weewx.Options{
+		AlwaysDeriveDewPoint: c.AlwaysDeriveDewPoint,
+		SkyTemperatureField:  c.SkyTemperatureField,
+		CloudModel:           cloudModel(c),
+		SkyQualityField:      c.SkyQualityField,
+		SkyQualityMeter:      meter,
+		SkyCamera:            skyCamera,
+		Calibration:          calibration(c),
+	}, log)
+
+	err = applySettings(store, devices)
+	if err != nil {
+		log.Error("error applying saved settings", zap.Error(err))
+		return
+	}
+
+	for i, source := range sources {
+		source.Start()
+		sup.started(fmt.Sprintf("source %d", i), source.Stop)
+	}
+
+	rules := safetyRules(c)
+	if saved, ok := store.Safety(); ok {
+		rules = saved
+	}
+
+	monitor := safety.NewMonitor(rules, devices[0].Source.GetCurrent, 5*time.Second, log)
+	monitor.Start()
+	sup.started("safety monitor", monitor.Stop)
+
+	h := handler.New(devices, fwhmStore, monitor, sw, store, handler.Identity{
+		ServerName:            c.ServerName,
+		Manufacturer:          c.Manufacturer,
+		Location:              c.Location,
+		SafetyMonitorName:     c.SafetyMonitorName,
+		SafetyMonitorUniqueID: deviceID(id, "safetymonitor"),
+		SwitchName:            c.SwitchName,
+		SwitchUniqueID:        deviceID(id, "switch"),
+	})
+
+	r := router.NewRouter(h, log, c.FWHMAPIKey, c.AdminAPIKey)
+
+	var adv *advertisement
+	if c.MDNS {
+		adv, err = startAdvertisement(c, id, h, log)
+		if err != nil {
+			log.Error("error starting mdns", zap.Error(err))
+			return
+		}
+
+		sup.started("mdns", adv.stop)
+	}
+
+	if c.ConfigFile != "" {
+		rl := newReloader(c, devices, store, monitor, adv, log)
+
+		reloadCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			rl.run(reloadCtx)
+		}()
+
+		sup.started("config reloader", func() {
+			cancel()
+			<-done
+		})
+	}
+
+	err = runHTTPServer(ctx, r, log, fmt.Sprintf("%s:%d", c.ListenIPAddress, c.ListenPort), c.ShutdownTimeout)
+	if err != nil {
+		log.Error("error running server", zap.Error(err))
+		return
+	}
 
-	log.Info("exiting")
+	// A second signal kills the process instead of waiting for the shutdown.
+	stop()
 }
 
-func startHTTPServer(h http.Handler, log *zap.Logger, serverAddr string) error {
+// runHTTPServer serves h until ctx is done, then waits up to timeout for the
+// requests in flight.
+func runHTTPServer(ctx context.Context, h http.Handler, log *zap.Logger, serverAddr string, timeout time.Duration) error {
 	httpServer := &http.Server{
 		Addr:    serverAddr,
 		Handler: h,
@@ -84,6 +425,6 @@ func startHTTPServer(h http.Handler, log *zap.Logger, serverAddr string) error {
 	log.Info("starting server", zap.String("addr", serverAddr))
 
 	// Start the http server.
-	s := server.NewGracefulHTTPServer(log, httpServer, ln, 30*time.Second)
-	return s.Run()
+	s := server.NewGracefulHTTPServer(log, httpServer, ln, timeout)
+	return s.Run(ctx)
 }
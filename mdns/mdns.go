@@ -0,0 +1,151 @@
+// Package mdns advertises the Alpaca API and the setup pages over multicast
+// DNS, for clients that find services through zeroconf rather than the Alpaca
+// discovery protocol.
+package mdns
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/grandcat/zeroconf"
+	"go.uber.org/zap"
+)
+
+const (
+	// AlpacaService is the service type of the Alpaca API.
+	AlpacaService = "_alpaca._tcp"
+	// HTTPService is the service type of the setup pages.
+	HTTPService = "_http._tcp"
+
+	domain = "local."
+)
+
+// Info is what is advertised.
+type Info struct {
+	// Instance is the service instance name shown to users.
+	Instance string
+	// Port is the port of the HTTP server.
+	Port int
+	// UniqueID identifies the server.
+	UniqueID string
+	// DeviceTypes are the Alpaca device types served.
+	DeviceTypes []string
+	// APIVersions are the supported Alpaca API versions.
+	APIVersions []int
+}
+
+// alpacaText returns the TXT records of the Alpaca service.
+func (i Info) alpacaText() []string {
+	types := append([]string(nil), i.DeviceTypes...)
+	sort.Strings(types)
+
+	versions := make([]string, 0, len(i.APIVersions))
+	for _, v := range i.APIVersions {
+		versions = append(versions, fmt.Sprint(v))
+	}
+
+	return []string{
+		"apiversions=" + strings.Join(versions, ","),
+		"devicetypes=" + strings.Join(dedupe(types), ","),
+		"uniqueid=" + i.UniqueID,
+	}
+}
+
+// httpText returns the TXT records of the setup pages.
+func (i Info) httpText() []string {
+	return []string{
+		"path=/setup",
+		"uniqueid=" + i.UniqueID,
+	}
+}
+
+func dedupe(sorted []string) []string {
+	out := sorted[:0]
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+// Advertiser answers mDNS queries for the Alpaca API and the setup pages.
+type Advertiser struct {
+	log *zap.Logger
+
+	mu     sync.Mutex
+	info   Info
+	alpaca *zeroconf.Server
+	http   *zeroconf.Server
+}
+
+// Start advertises the services on every multicast capable interface.
+func Start(info Info, log *zap.Logger) (*Advertiser, error) {
+	alpaca, err := zeroconf.Register(info.Instance, AlpacaService, domain, info.Port, info.alpacaText(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("advertising %s: %w", AlpacaService, err)
+	}
+
+	http, err := zeroconf.Register(info.Instance, HTTPService, domain, info.Port, info.httpText(), nil)
+	if err != nil {
+		alpaca.Shutdown()
+		return nil, fmt.Errorf("advertising %s: %w", HTTPService, err)
+	}
+
+	log.Info("advertising over mdns", zap.String("instance", info.Instance), zap.Strings("txt", info.alpacaText()))
+
+	return &Advertiser{
+		log:    log,
+		info:   info,
+		alpaca: alpaca,
+		http:   http,
+	}, nil
+}
+
+// Rename registers the services again under a new instance name. Nothing
+// changes when the name is the same.
+func (a *Advertiser) Rename(instance string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if instance == a.info.Instance {
+		return
+	}
+
+	info := a.info
+	info.Instance = instance
+
+	alpaca, err := zeroconf.Register(info.Instance, AlpacaService, domain, info.Port, info.alpacaText(), nil)
+	if err != nil {
+		a.log.Error("error renaming mdns advertisement", zap.String("instance", info.Instance), zap.Error(err))
+		return
+	}
+
+	http, err := zeroconf.Register(info.Instance, HTTPService, domain, info.Port, info.httpText(), nil)
+	if err != nil {
+		alpaca.Shutdown()
+		a.log.Error("error renaming mdns advertisement", zap.String("instance", info.Instance), zap.Error(err))
+		return
+	}
+
+	a.alpaca.Shutdown()
+	a.http.Shutdown()
+
+	a.alpaca = alpaca
+	a.http = http
+	a.info = info
+
+	a.log.Info("advertising over mdns", zap.String("instance", info.Instance), zap.Strings("txt", info.alpacaText()))
+}
+
+// Stop withdraws the advertisement.
+func (a *Advertiser) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.alpaca.Shutdown()
+	a.http.Shutdown()
+}
@@ -11,81 +11,75 @@ import (
 
 var serverTransactionID atomic.Int64
 
-// TraceID tries to read the X-Trace-Id request header, and if empty, creates
-// a new traceID to use. This traceID will be added to the response X-Trace-Id
-// header and to the request context.
+// Alpaca reads the Alpaca parameters of the request into the request context,
+// along with the device the request is for. A malformed ClientID or
+// ClientTransactionID is answered with a 400 response.
 func Alpaca(next http.Handler) http.Handler {
-	badRequest := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.WriteHeader(http.StatusBadRequest)
-	})
-
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var ctx alpaca.AlpacaContext
-
-		if r.Method == http.MethodGet {
-			query := r.URL.Query()
-
-			var err error
-			var clientID uint64 = 0
-			var clientTransactionID uint64 = 0
-
-			for k, vs := range query {
-				if strings.ToLower(k) == "clientid" {
-					clientID, err = strconv.ParseUint(vs[0], 10, 64)
-					if err != nil {
-						badRequest.ServeHTTP(w, r)
-						return
-					}
-				} else if strings.ToLower(k) == "clienttransactionid" {
-					clientTransactionID, err = strconv.ParseUint(vs[0], 10, 64)
-					if err != nil {
-						badRequest.ServeHTTP(w, r)
-						return
-					}
-				}
-			}
+		values := r.URL.Query()
 
-			ctx = alpaca.AlpacaContext{
-				ClientID:            clientID,
-				ClientTransactionID: clientTransactionID,
-				ServerTransactionID: uint64(serverTransactionID.Add(1)),
-			}
-		} else {
+		if r.Method != http.MethodGet {
 			err := r.ParseForm()
 			if err != nil {
-				badRequest.ServeHTTP(w, r)
+				BadRequest(w, err.Error())
 				return
 			}
 
-			var clientID uint64 = 0
-			var clientTransactionID uint64 = 0
-
-			for k, vs := range r.PostForm {
-				if k == "ClientID" {
-					clientID, err = strconv.ParseUint(vs[0], 10, 64)
-					if err != nil {
-						badRequest.ServeHTTP(w, r)
-						return
-					}
-				} else if k == "ClientTransactionID" {
-					clientTransactionID, err = strconv.ParseUint(vs[0], 10, 64)
-					if err != nil {
-						badRequest.ServeHTTP(w, r)
-						return
-					}
-				}
-			}
+			values = r.PostForm
+		}
 
-			ctx = alpaca.AlpacaContext{
-				ClientID:            clientID,
-				ClientTransactionID: clientTransactionID,
-				ServerTransactionID: uint64(serverTransactionID.Add(1)),
-			}
+		params := alpaca.NewParams(r.Method, values)
+
+		clientID, err := params.Uint32("ClientID")
+		if err != nil {
+			BadRequest(w, err.Error())
+			return
+		}
+
+		clientTransactionID, err := params.Uint32("ClientTransactionID")
+		if err != nil {
+			BadRequest(w, err.Error())
+			return
 		}
 
+		ctx := alpaca.AlpacaContext{
+			ClientID:            uint64(clientID),
+			ClientTransactionID: uint64(clientTransactionID),
+			ServerTransactionID: uint64(serverTransactionID.Add(1)),
+			Params:              params,
+		}
+
+		ctx.DeviceType, ctx.DeviceNumber = deviceFromPath(r.URL.Path)
+
 		r = r.WithContext(alpaca.WithAlpacaContext(r.Context(), ctx))
 		next.ServeHTTP(w, r)
 	})
 }
+
+// BadRequest writes a 400 response with the message as a plain text body, as
+// Alpaca clients expect for missing or malformed parameters.
+func BadRequest(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte(message)) // nolint
+}
+
+// deviceFromPath returns the device type and number from an Alpaca device API
+// path such as /api/v1/observingconditions/0/name, or a setup page path such
+// as /setup/v1/observingconditions/0/setup.
+func deviceFromPath(path string) (*string, *int) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 4 || (parts[0] != "api" && parts[0] != "setup") {
+		return nil, nil
+	}
+
+	deviceType := strings.ToLower(parts[2])
+
+	deviceNumber, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return &deviceType, nil
+	}
+
+	return &deviceType, &deviceNumber
+}
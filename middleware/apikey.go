@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// APIKey middleware rejects requests that do not carry the given key in the
+// X-Api-Key header.
+func APIKey(key string, unauthorized http.HandlerFunc) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Api-Key")), []byte(key)) != 1 {
+				unauthorized(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
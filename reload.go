@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/handler"
+	"github.com/darkdragonsastro/weewx-json-alpaca/safety"
+	"github.com/darkdragonsastro/weewx-json-alpaca/settings"
+)
+
+// liveSettings are the variables whose changes are applied without a restart:
+// the WeeWX settings of the devices, the safety rules and the mDNS name.
+// Settings saved from the setup pages still take precedence over them.
+var liveSettings = map[string]bool{
+	"WEEWX_URL":              true,
+	"ALWAYS_DERIVE_DEWPOINT": true,
+	"SKY_TEMPERATURE_FIELD":  true,
+	"SKY_QUALITY_FIELD":      true,
+	"MDNS_NAME":              true,
+}
+
+func isLive(name string) bool {
+	return liveSettings[name] || strings.HasPrefix(name, "CLOUD_") || strings.HasPrefix(name, "CALIBRATION_") || strings.HasPrefix(name, "SAFETY_")
+}
+
+// reloader reloads the configuration file when it changes or on SIGHUP. A
+// configuration that does not load or validate is rejected, and the running
+// one kept.
+type reloader struct {
+	log     *zap.Logger
+	devices []handler.Device
+	store   *settings.Store
+	monitor *safety.Monitor
+
+	// advertisement is nil when mDNS is off.
+	advertisement *advertisement
+
+	// started is the configuration the server started with. Changes that
+	// need a restart are reported against it.
+	started config
+
+	modTime time.Time
+	size    int64
+}
+
+func newReloader(c config, devices []handler.Device, store *settings.Store, monitor *safety.Monitor, adv *advertisement, log *zap.Logger) *reloader {
+	r := &reloader{
+		log:           log.With(zap.String("file", c.ConfigFile)),
+		devices:       devices,
+		store:         store,
+		monitor:       monitor,
+		advertisement: adv,
+		started:       c,
+	}
+
+	r.changed()
+
+	return r
+}
+
+// run watches the file until ctx is done.
+func (r *reloader) run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(r.started.ConfigWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.changed()
+			r.reload("SIGHUP")
+		case <-ticker.C:
+			if r.changed() {
+				r.reload("file changed")
+			}
+		}
+	}
+}
+
+// changed reports whether the file changed since the last call.
+func (r *reloader) changed() bool {
+	fi, err := os.Stat(r.started.ConfigFile)
+	if err != nil {
+		return false
+	}
+
+	if fi.ModTime().Equal(r.modTime) && fi.Size() == r.size {
+		return false
+	}
+
+	r.modTime = fi.ModTime()
+	r.size = fi.Size()
+
+	return true
+}
+
+func (r *reloader) reload(reason string) {
+	c, err := loadConfig(r.started.ConfigFile)
+	if err != nil {
+		r.log.Error("rejected configuration, keeping the running one", zap.String("reason", reason), zap.Error(err))
+		return
+	}
+
+	r.apply(c)
+
+	var restart []string
+	for _, name := range changedSettings(r.started, c) {
+		if !isLive(name) {
+			restart = append(restart, strings.ToLower(name))
+		}
+	}
+
+	r.log.Info("configuration reloaded", zap.String("reason", reason))
+
+	if len(restart) > 0 {
+		r.log.Warn("configuration changes that need a restart", zap.Strings("settings", restart))
+	}
+}
+
+// apply configures the devices and the safety monitor, unless their settings
+// were saved from the setup pages, and updates the mDNS advertisement.
+func (r *reloader) apply(c config) {
+	// The extra devices are only reconfigured while the list is as it was
+	// when the server started, so that they still match up.
+	n := 1
+	if reflect.DeepEqual(c.ExtraDevices, r.started.ExtraDevices) {
+		n += len(c.ExtraDevices.Devices)
+	}
+
+	for i := 0; i < n && i < len(r.devices); i++ {
+		d := r.devices[i]
+
+		cfg, ok := d.Source.(handler.Configurable)
+		if !ok {
+			continue
+		}
+
+		if _, saved := r.store.Device(d.UniqueID); saved {
+			continue
+		}
+
+		s := deviceSettings(c, i, cfg.Settings())
+		if s == cfg.Settings() {
+			continue
+		}
+
+		err := cfg.Configure(s)
+		if err != nil {
+			r.log.Error("error reconfiguring device", zap.String("device", d.Name), zap.Error(err))
+		}
+	}
+
+	if _, saved := r.store.Safety(); !saved {
+		rules := safetyRules(c)
+		if rules != r.monitor.Rules() {
+			err := r.monitor.SetRules(rules)
+			if err != nil {
+				r.log.Error("error setting safety rules", zap.Error(err))
+			}
+		}
+	}
+
+	if r.advertisement != nil {
+		r.advertisement.configure(c)
+	}
+}
+
+// changedSettings returns the names of the variables whose values differ.
+func changedSettings(a, b config) []string {
+	var names []string
+
+	va := reflect.ValueOf(a)
+	vb := reflect.ValueOf(b)
+
+	for i := 0; i < va.NumField(); i++ {
+		name, _, _ := strings.Cut(va.Type().Field(i).Tag.Get("env"), ",")
+		if name == "" {
+			continue
+		}
+
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,75 @@
+package remote
+
+import (
+	"github.com/darkdragonsastro/weewx-json-alpaca/weewx"
+)
+
+// Merged serves the WeeWX conditions, with the values WeeWX does not have
+// taken from a remote device. Everything else, such as the settings and the
+// report, comes from the WeeWX client.
+type Merged struct {
+	*weewx.Client
+
+	Remote *Source
+}
+
+// Merge returns a source merging the remote device into the WeeWX client.
+func Merge(c *weewx.Client, remote *Source) *Merged {
+	return &Merged{
+		Client: c,
+		Remote: remote,
+	}
+}
+
+// GetCurrent returns the WeeWX conditions, completed with the remote values.
+// It is connected when either is, and dated by WeeWX unless only the remote
+// device is connected.
+func (m *Merged) GetCurrent() *weewx.ObservingConditions {
+	local := m.Client.GetCurrent()
+	remote := m.Remote.GetCurrent()
+
+	merged := *local
+
+	if !remote.Connected {
+		return &merged
+	}
+
+	for _, sensor := range sensors {
+		f := field(&merged, sensor)
+		if *f == nil || !m.Client.Supports(sensor) {
+			*f = *field(remote, sensor)
+		}
+	}
+
+	if !local.Connected {
+		merged.Connected = true
+		merged.LastUpdated = remote.LastUpdated
+	}
+
+	return &merged
+}
+
+// Supports reports whether WeeWX or the remote device has the sensor.
+func (m *Merged) Supports(sensor string) bool {
+	return m.Client.Supports(sensor) || m.Remote.Supports(sensor)
+}
+
+func (m *Merged) Start() {
+	m.Client.Start()
+	m.Remote.Start()
+}
+
+func (m *Merged) Stop() {
+	m.Remote.Stop()
+	m.Client.Stop()
+}
+
+// Connect connects both in the background.
+func (m *Merged) Connect() {
+	m.Client.Connect()
+	m.Remote.Connect()
+}
+
+func (m *Merged) Connecting() bool {
+	return m.Client.Connecting() || m.Remote.Connecting()
+}
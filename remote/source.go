@@ -0,0 +1,468 @@
+// Package remote serves the conditions of an ObservingConditions device on
+// another Alpaca server, such as a Windows driver behind ASCOM Remote, either
+// on their own or merged with the WeeWX conditions.
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/httputil"
+	"github.com/darkdragonsastro/weewx-json-alpaca/weewx"
+)
+
+// Alpaca error numbers the source acts on.
+const (
+	errNotImplemented = 0x400
+	errValueNotSet    = 0x402
+	errNotConnected   = 0x407
+)
+
+// sensors are the ObservingConditions properties polled, by the lower case
+// name used in the API paths and by Supports.
+var sensors = []string{
+	"cloudcover",
+	"dewpoint",
+	"humidity",
+	"pressure",
+	"rainrate",
+	"skybrightness",
+	"skyquality",
+	"skytemperature",
+	"temperature",
+	"winddirection",
+	"windgust",
+	"windspeed",
+}
+
+// field returns the field of oc holding the sensor's value.
+func field(oc *weewx.ObservingConditions, sensor string) **float64 {
+	switch sensor {
+	case "cloudcover":
+		return &oc.CloudCover
+	case "dewpoint":
+		return &oc.DewPoint
+	case "humidity":
+		return &oc.Humidity
+	case "pressure":
+		return &oc.Pressure
+	case "rainrate":
+		return &oc.RainRate
+	case "skybrightness":
+		return &oc.SkyBrightness
+	case "skyquality":
+		return &oc.SkyQuality
+	case "skytemperature":
+		return &oc.SkyTemperature
+	case "temperature":
+		return &oc.Temperature
+	case "winddirection":
+		return &oc.WindDirection
+	case "windgust":
+		return &oc.WindGust
+	case "windspeed":
+		return &oc.WindSpeed
+	}
+
+	return nil
+}
+
+// alpacaError is an error returned by the remote device.
+type alpacaError struct {
+	Number  int
+	Message string
+}
+
+func (e *alpacaError) Error() string {
+	return fmt.Sprintf("alpaca error 0x%X: %s", e.Number, e.Message)
+}
+
+// notImplemented reports whether err says the device does not have what was
+// asked for, rather than that it failed for now. Servers older than DeviceState
+// answer with 400 or 404.
+func notImplemented(err error) bool {
+	if errorNumber(err) == errNotImplemented {
+		return true
+	}
+
+	var he *httpError
+	if errors.As(err, &he) {
+		return he.StatusCode == http.StatusBadRequest || he.StatusCode == http.StatusNotFound
+	}
+
+	return false
+}
+
+func errorNumber(err error) int {
+	var ae *alpacaError
+	if errors.As(err, &ae) {
+		return ae.Number
+	}
+
+	return 0
+}
+
+// Source polls an ObservingConditions device on another Alpaca server. It
+// reads DeviceState when the device has it, and every property on its own
+// otherwise.
+type Source struct {
+	url      string
+	clientID uint32
+	interval time.Duration
+	c        *http.Client
+	log      *zap.Logger
+
+	val       atomic.Pointer[weewx.ObservingConditions]
+	supported atomic.Pointer[map[string]bool]
+	txID      atomic.Uint32
+
+	// remoteConnected and noDeviceState are only used by the polling
+	// goroutine, or by Start and Stop while it is not running.
+	remoteConnected bool
+	noDeviceState   bool
+
+	mu         sync.Mutex
+	cancel     context.CancelFunc
+	stopped    chan struct{}
+	connecting atomic.Bool
+}
+
+// NewSource returns a source for the ObservingConditions device deviceNumber
+// of the Alpaca server at serverURL, such as http://host:11111.
+func NewSource(serverURL string, deviceNumber int, interval time.Duration, log *zap.Logger) *Source {
+	log = log.With(zap.String("remote", serverURL), zap.Int("remote_device_number", deviceNumber))
+
+	s := &Source{
+		url:      fmt.Sprintf("%s/api/v1/observingconditions/%d", strings.TrimSuffix(serverURL, "/"), deviceNumber),
+		clientID: uint32(rand.Int31n(65535) + 1),
+		interval: interval,
+		c: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: httputil.DefaultLogTransport(log, httputil.LogTransport(http.DefaultTransport)),
+		},
+		log: log,
+	}
+
+	s.val.Store(&weewx.ObservingConditions{})
+	s.supported.Store(&map[string]bool{})
+
+	return s
+}
+
+func (s *Source) GetCurrent() *weewx.ObservingConditions {
+	return s.val.Load()
+}
+
+// Supports reports whether the remote device has the sensor. Nothing is
+// supported before the first successful poll.
+func (s *Source) Supports(sensor string) bool {
+	return (*s.supported.Load())[sensor]
+}
+
+// Start polls the device once and then in the background until Stop is
+// called. Starting a running source does nothing.
+func (s *Source) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return
+	}
+
+	s.log.Info("starting remote alpaca source")
+
+	err := s.refresh(context.Background())
+	if err != nil {
+		s.log.Error("error polling remote device", zap.Error(err))
+	}
+
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	s.stopped = make(chan struct{})
+
+	go s.poll(ctx, s.stopped)
+}
+
+func (s *Source) poll(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := s.refresh(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.log.Error("error polling remote device", zap.Error(err))
+		}
+	}
+}
+
+// Stop stops polling and disconnects from the remote device.
+func (s *Source) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel == nil {
+		return
+	}
+
+	s.cancel()
+	<-s.stopped
+
+	s.cancel = nil
+	s.stopped = nil
+
+	if s.remoteConnected {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err := s.put(ctx, "connected", url.Values{"Connected": {"False"}})
+		cancel()
+		if err != nil {
+			s.log.Warn("error disconnecting from remote device", zap.Error(err))
+		}
+
+		s.remoteConnected = false
+	}
+
+	s.val.Store(&weewx.ObservingConditions{
+		Connected: false,
+	})
+
+	s.log.Info("stopping remote alpaca source")
+}
+
+// Connect starts the source in the background. Connecting reports true until
+// the first poll has finished.
+func (s *Source) Connect() {
+	s.connecting.Store(true)
+
+	go func() {
+		s.Start()
+		s.connecting.Store(false)
+	}()
+}
+
+// Connecting reports whether a Connect is still in progress.
+func (s *Source) Connecting() bool {
+	return s.connecting.Load()
+}
+
+// refresh connects to the remote device if needed and reads its conditions.
+func (s *Source) refresh(ctx context.Context) error {
+	if !s.remoteConnected {
+		err := s.put(ctx, "connected", url.Values{"Connected": {"True"}})
+		if err != nil {
+			return fmt.Errorf("connecting: %w", err)
+		}
+
+		s.remoteConnected = true
+	}
+
+	oc, supported, err := s.read(ctx)
+	if errorNumber(err) == errNotConnected {
+		// The device was disconnected behind our back, by a restart or by
+		// another client. Connect again on the next poll.
+		s.remoteConnected = false
+	}
+	if err != nil {
+		return err
+	}
+
+	oc.Connected = true
+
+	s.val.Store(oc)
+	s.supported.Store(&supported)
+
+	return nil
+}
+
+func (s *Source) read(ctx context.Context) (*weewx.ObservingConditions, map[string]bool, error) {
+	if !s.noDeviceState {
+		oc, supported, err := s.readDeviceState(ctx)
+		if err == nil {
+			return oc, supported, nil
+		}
+
+		if !notImplemented(err) {
+			return nil, nil, err
+		}
+
+		s.log.Info("remote device has no DeviceState, reading properties one by one", zap.Error(err))
+		s.noDeviceState = true
+	}
+
+	return s.readProperties(ctx)
+}
+
+// readDeviceState reads every value in one request. Properties the device
+// does not implement are left out of the state.
+func (s *Source) readDeviceState(ctx context.Context) (*weewx.ObservingConditions, map[string]bool, error) {
+	var state []struct {
+		Name  string      `json:"Name"`
+		Value interface{} `json:"Value"`
+	}
+
+	err := s.get(ctx, "devicestate", nil, &state)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	oc := &weewx.ObservingConditions{LastUpdated: time.Now()}
+	supported := make(map[string]bool)
+
+	for _, v := range state {
+		name := strings.ToLower(v.Name)
+
+		if name == "timestamp" {
+			if ts, ok := v.Value.(string); ok {
+				t, err := time.Parse(time.RFC3339Nano, ts)
+				if err == nil {
+					oc.LastUpdated = t
+				}
+			}
+			continue
+		}
+
+		f := field(oc, name)
+		if f == nil {
+			continue
+		}
+
+		supported[name] = true
+
+		if n, ok := v.Value.(float64); ok {
+			*f = &n
+		}
+	}
+
+	return oc, supported, nil
+}
+
+// readProperties reads the properties one by one.
+func (s *Source) readProperties(ctx context.Context) (*weewx.ObservingConditions, map[string]bool, error) {
+	oc := &weewx.ObservingConditions{LastUpdated: time.Now()}
+	supported := make(map[string]bool)
+
+	for _, sensor := range sensors {
+		var v float64
+
+		err := s.get(ctx, sensor, nil, &v)
+		if errorNumber(err) == errNotImplemented {
+			continue
+		}
+		if errorNumber(err) == errValueNotSet {
+			supported[sensor] = true
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", sensor, err)
+		}
+
+		supported[sensor] = true
+		*field(oc, sensor) = &v
+	}
+
+	var since float64
+	err := s.get(ctx, "timesincelastupdate", url.Values{"SensorName": {""}}, &since)
+	if err == nil && since >= 0 {
+		oc.LastUpdated = time.Now().Add(-time.Duration(since * float64(time.Second)))
+	}
+
+	return oc, supported, nil
+}
+
+// httpError is a response with a status other than 200.
+type httpError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *httpError) Error() string {
+	return "unexpected status " + e.Status
+}
+
+func (s *Source) get(ctx context.Context, property string, params url.Values, value interface{}) error {
+	values := s.transaction()
+	for k, v := range params {
+		values[k] = v
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url+"/"+property+"?"+values.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	return s.do(req, value)
+}
+
+func (s *Source) put(ctx context.Context, property string, values url.Values) error {
+	for k, v := range s.transaction() {
+		values[k] = v
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.url+"/"+property, strings.NewReader(values.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return s.do(req, nil)
+}
+
+func (s *Source) transaction() url.Values {
+	return url.Values{
+		"ClientID":            {strconv.FormatUint(uint64(s.clientID), 10)},
+		"ClientTransactionID": {strconv.FormatUint(uint64(s.txID.Add(1)), 10)},
+	}
+}
+
+func (s *Source) do(req *http.Request, value interface{}) error {
+	resp, err := s.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &httpError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	body := struct {
+		Value        interface{} `json:"Value"`
+		ErrorNumber  int         `json:"ErrorNumber"`
+		ErrorMessage string      `json:"ErrorMessage"`
+	}{
+		Value: value,
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return err
+	}
+
+	if body.ErrorNumber != 0 {
+		return &alpacaError{Number: body.ErrorNumber, Message: body.ErrorMessage}
+	}
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// reply is the answer of the fake device to a request: a value, an Alpaca
+// error or, when status is set, a bare HTTP status.
+type reply struct {
+	value  any
+	err    int
+	status int
+}
+
+// fakeDevice is an ObservingConditions device on a fake Alpaca server.
+// Properties without a reply are not implemented.
+type fakeDevice struct {
+	replies map[string]reply
+
+	mu        sync.Mutex
+	requests  []string
+	connected bool
+}
+
+func (d *fakeDevice) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	property := strings.TrimPrefix(r.URL.Path, "/api/v1/observingconditions/0/")
+
+	d.mu.Lock()
+	d.requests = append(d.requests, r.Method+" "+property)
+	if r.Method == http.MethodPut && property == "connected" {
+		d.connected = r.FormValue("Connected") == "True"
+	}
+	d.mu.Unlock()
+
+	rep, ok := d.replies[property]
+	if r.Method == http.MethodPut {
+		rep, ok = reply{}, true
+	}
+	if !ok {
+		rep = reply{err: errNotImplemented}
+	}
+
+	if rep.status != 0 {
+		w.WriteHeader(rep.status)
+		return
+	}
+
+	body := map[string]any{"Value": rep.value, "ErrorNumber": rep.err}
+	if rep.err != 0 {
+		body["ErrorMessage"] = "error"
+	}
+
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// count returns how many requests were made for the property.
+func (d *fakeDevice) count(method, property string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n := 0
+	for _, r := range d.requests {
+		if r == method+" "+property {
+			n++
+		}
+	}
+
+	return n
+}
+
+func newFakeDevice(t *testing.T, replies map[string]reply) (*fakeDevice, *Source) {
+	t.Helper()
+
+	d := &fakeDevice{replies: replies}
+
+	srv := httptest.NewServer(d)
+	t.Cleanup(srv.Close)
+
+	return d, NewSource(srv.URL, 0, time.Hour, zap.NewNop())
+}
+
+func TestSourceReadsDeviceState(t *testing.T) {
+	timestamp := time.Date(2024, 3, 1, 22, 15, 0, 0, time.UTC)
+
+	d, s := newFakeDevice(t, map[string]reply{
+		"devicestate": {value: []map[string]any{
+			{"Name": "Temperature", "Value": 12.5},
+			{"Name": "Humidity", "Value": 80.0},
+			{"Name": "SkyQuality", "Value": nil},
+			{"Name": "TimeStamp", "Value": timestamp.Format(time.RFC3339Nano)},
+			{"Name": "Vendor", "Value": "ignored"},
+		}},
+	})
+
+	s.Start()
+
+	oc := s.GetCurrent()
+	if !oc.Connected {
+		t.Fatal("not connected after starting")
+	}
+	if oc.Temperature == nil || *oc.Temperature != 12.5 || oc.Humidity == nil || *oc.Humidity != 80 {
+		t.Errorf("conditions %+v, want temperature 12.5 and humidity 80", oc)
+	}
+	if oc.SkyQuality != nil {
+		t.Errorf("sky quality %g, want unset", *oc.SkyQuality)
+	}
+	if !oc.LastUpdated.Equal(timestamp) {
+		t.Errorf("last updated %s, want %s", oc.LastUpdated, timestamp)
+	}
+
+	for sensor, want := range map[string]bool{"temperature": true, "humidity": true, "skyquality": true, "pressure": false} {
+		if s.Supports(sensor) != want {
+			t.Errorf("Supports(%q) = %t, want %t", sensor, !want, want)
+		}
+	}
+
+	if n := d.count(http.MethodGet, "temperature"); n != 0 {
+		t.Errorf("read temperature %d times on its own, want DeviceState only", n)
+	}
+
+	s.Stop()
+
+	if d.connected {
+		t.Error("remote device still connected after stopping")
+	}
+	if s.GetCurrent().Connected {
+		t.Error("source connected after stopping")
+	}
+}
+
+func TestSourceFallsBackToProperties(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		deviceState reply
+	}{
+		{"not implemented", reply{err: errNotImplemented}},
+		{"bad request", reply{status: http.StatusBadRequest}},
+		{"not found", reply{status: http.StatusNotFound}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d, s := newFakeDevice(t, map[string]reply{
+				"devicestate":         tt.deviceState,
+				"temperature":         {value: 12.5},
+				"pressure":            {value: 1013.2},
+				"skyquality":          {err: errValueNotSet},
+				"timesincelastupdate": {value: 30.0},
+			})
+
+			err := s.refresh(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			oc := s.GetCurrent()
+			if oc.Temperature == nil || *oc.Temperature != 12.5 || oc.Pressure == nil || *oc.Pressure != 1013.2 {
+				t.Errorf("conditions %+v, want temperature 12.5 and pressure 1013.2", oc)
+			}
+			if age := time.Since(oc.LastUpdated); age < 30*time.Second || age > 40*time.Second {
+				t.Errorf("conditions are %s old, want 30s", age)
+			}
+
+			for sensor, want := range map[string]bool{"temperature": true, "skyquality": true, "humidity": false} {
+				if s.Supports(sensor) != want {
+					t.Errorf("Supports(%q) = %t, want %t", sensor, !want, want)
+				}
+			}
+
+			err = s.refresh(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if n := d.count(http.MethodGet, "devicestate"); n != 1 {
+				t.Errorf("asked for DeviceState %d times, want once", n)
+			}
+			if n := d.count(http.MethodGet, "temperature"); n != 2 {
+				t.Errorf("read temperature %d times, want twice", n)
+			}
+		})
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	t.Run("server error", func(t *testing.T) {
+		d, s := newFakeDevice(t, map[string]reply{
+			"devicestate": {status: http.StatusInternalServerError},
+			"temperature": {value: 12.5},
+		})
+
+		err := s.refresh(context.Background())
+		if err == nil {
+			t.Fatal("no error from a failing server")
+		}
+
+		if s.GetCurrent().Connected || s.Supports("temperature") {
+			t.Error("connected or supporting sensors without a successful poll")
+		}
+
+		// A failure is not a missing DeviceState, so it is asked for again.
+		_ = s.refresh(context.Background())
+		if n := d.count(http.MethodGet, "devicestate"); n != 2 {
+			t.Errorf("asked for DeviceState %d times, want twice", n)
+		}
+		if n := d.count(http.MethodGet, "temperature"); n != 0 {
+			t.Errorf("read temperature %d times, want none", n)
+		}
+	})
+
+	t.Run("property error", func(t *testing.T) {
+		_, s := newFakeDevice(t, map[string]reply{
+			"temperature": {status: http.StatusInternalServerError},
+		})
+
+		err := s.refresh(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "temperature") {
+			t.Errorf("error %v, want one naming temperature", err)
+		}
+	})
+
+	t.Run("not connected", func(t *testing.T) {
+		d, s := newFakeDevice(t, map[string]reply{
+			"devicestate": {err: errNotConnected},
+		})
+
+		err := s.refresh(context.Background())
+		if err == nil {
+			t.Fatal("no error from a disconnected device")
+		}
+
+		_ = s.refresh(context.Background())
+		if n := d.count(http.MethodPut, "connected"); n != 2 {
+			t.Errorf("connected %d times, want again after the device was disconnected", n)
+		}
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+
+		s := NewSource(srv.URL, 0, time.Hour, zap.NewNop())
+
+		err := s.refresh(context.Background())
+		if err == nil {
+			t.Fatal("no error from an unreachable server")
+		}
+		if s.GetCurrent().Connected {
+			t.Error("connected to an unreachable server")
+		}
+	})
+}
@@ -8,21 +8,29 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/darkdragonsastro/weewx-json-alpaca/middleware"
+	"github.com/darkdragonsastro/weewx-json-alpaca/version"
 )
 
 // Handler exposes the functions for handling web requests.
 type Handler interface {
 	Health(w http.ResponseWriter, r *http.Request)
 	NotFound(w http.ResponseWriter, r *http.Request)
+	Unauthorized(w http.ResponseWriter, r *http.Request)
+	PostFWHM(w http.ResponseWriter, r *http.Request)
 	ApiVersions(w http.ResponseWriter, r *http.Request)
+	Version(w http.ResponseWriter, r *http.Request)
 	Description(w http.ResponseWriter, r *http.Request)
 	ConfiguredDevices(w http.ResponseWriter, r *http.Request)
+	Clients(w http.ResponseWriter, r *http.Request)
 	PutAction(w http.ResponseWriter, r *http.Request)
 	PutCommandBlind(w http.ResponseWriter, r *http.Request)
 	PutCommandBool(w http.ResponseWriter, r *http.Request)
 	PutCommandString(w http.ResponseWriter, r *http.Request)
 	GetConnected(w http.ResponseWriter, r *http.Request)
 	PutConnected(w http.ResponseWriter, r *http.Request)
+	PutConnect(w http.ResponseWriter, r *http.Request)
+	PutDisconnect(w http.ResponseWriter, r *http.Request)
+	GetConnecting(w http.ResponseWriter, r *http.Request)
 	GetDescription(w http.ResponseWriter, r *http.Request)
 	GetDriverInfo(w http.ResponseWriter, r *http.Request)
 	GetDriverVersion(w http.ResponseWriter, r *http.Request)
@@ -47,54 +55,158 @@ type Handler interface {
 	PutRefresh(w http.ResponseWriter, r *http.Request)
 	GetSensorDescription(w http.ResponseWriter, r *http.Request)
 	GetTimeSinceLastUpdate(w http.ResponseWriter, r *http.Request)
+	GetDeviceState(w http.ResponseWriter, r *http.Request)
+	GetIsSafe(w http.ResponseWriter, r *http.Request)
+	GetMaxSwitch(w http.ResponseWriter, r *http.Request)
+	GetCanWrite(w http.ResponseWriter, r *http.Request)
+	GetSwitch(w http.ResponseWriter, r *http.Request)
+	GetSwitchDescription(w http.ResponseWriter, r *http.Request)
+	GetSwitchName(w http.ResponseWriter, r *http.Request)
+	GetSwitchValue(w http.ResponseWriter, r *http.Request)
+	GetMinSwitchValue(w http.ResponseWriter, r *http.Request)
+	GetMaxSwitchValue(w http.ResponseWriter, r *http.Request)
+	GetSwitchStep(w http.ResponseWriter, r *http.Request)
+	PutSetSwitch(w http.ResponseWriter, r *http.Request)
+	PutSetSwitchName(w http.ResponseWriter, r *http.Request)
+	PutSetSwitchValue(w http.ResponseWriter, r *http.Request)
+	Setup(w http.ResponseWriter, r *http.Request)
+	GetDeviceSetup(w http.ResponseWriter, r *http.Request)
+	PostDeviceSetup(w http.ResponseWriter, r *http.Request)
+	GetSafetySetup(w http.ResponseWriter, r *http.Request)
+	PostSafetySetup(w http.ResponseWriter, r *http.Request)
+	ValidDevice(next http.Handler) http.Handler
 }
 
 // NewRouter creates a new CORS enabled router for our API. All requests will be logged and
-// instrumented with New Relic.
-func NewRouter(h Handler, log *zap.Logger) http.Handler {
+// instrumented with New Relic. The FWHM push endpoint is only available when fwhmAPIKey is set,
+// and the list of clients only when adminAPIKey is set.
+func NewRouter(h Handler, log *zap.Logger, fwhmAPIKey, adminAPIKey string) http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.TraceID)
 	r.Use(middleware.Logger(log))
 	r.Use(middleware.Alpaca)
+	r.Use(middleware.Version(version.Get().String()))
 	r.NotFound(h.NotFound)
 
 	r.Get("/health", h.Health)
+	r.Get("/version", h.Version)
+
+	if fwhmAPIKey != "" {
+		r.With(middleware.APIKey(fwhmAPIKey, h.Unauthorized)).Post("/measurements/fwhm", h.PostFWHM)
+	}
 
 	r.Get("/management/apiversions", h.ApiVersions)
 	r.Get("/management/v1/description", h.Description)
 	r.Get("/management/v1/configureddevices", h.ConfiguredDevices)
 
-	r.Put("/api/v1/observingconditions/0/action", h.PutAction)
-	r.Put("/api/v1/observingconditions/0/commandblind", h.PutCommandBlind)
-	r.Put("/api/v1/observingconditions/0/commandbool", h.PutCommandBool)
-	r.Put("/api/v1/observingconditions/0/commandstring", h.PutCommandString)
-	r.Get("/api/v1/observingconditions/0/connected", h.GetConnected)
-	r.Put("/api/v1/observingconditions/0/connected", h.PutConnected)
-	r.Get("/api/v1/observingconditions/0/description", h.GetDescription)
-	r.Get("/api/v1/observingconditions/0/driverinfo", h.GetDriverInfo)
-	r.Get("/api/v1/observingconditions/0/driverversion", h.GetDriverVersion)
-	r.Get("/api/v1/observingconditions/0/interfaceversion", h.GetInterfaceVersion)
-	r.Get("/api/v1/observingconditions/0/name", h.GetName)
-	r.Get("/api/v1/observingconditions/0/supportedactions", h.GetSupportedActions)
-	r.Get("/api/v1/observingconditions/0/averageperiod", h.GetAveragePeriod)
-	r.Put("/api/v1/observingconditions/0/averageperiod", h.PutAveragePeriod)
-	r.Get("/api/v1/observingconditions/0/cloudcover", h.GetCloudCover)
-	r.Get("/api/v1/observingconditions/0/dewpoint", h.GetDewPoint)
-	r.Get("/api/v1/observingconditions/0/humidity", h.GetHumidity)
-	r.Get("/api/v1/observingconditions/0/pressure", h.GetPressure)
-	r.Get("/api/v1/observingconditions/0/rainrate", h.GetRainRate)
-	r.Get("/api/v1/observingconditions/0/skybrightness", h.GetSkyBrightness)
-	r.Get("/api/v1/observingconditions/0/skyquality", h.GetSkyQuality)
-	r.Get("/api/v1/observingconditions/0/skytemperature", h.GetSkyTemperature)
-	r.Get("/api/v1/observingconditions/0/starfwhm", h.GetStarFWHM)
-	r.Get("/api/v1/observingconditions/0/temperature", h.GetTemperature)
-	r.Get("/api/v1/observingconditions/0/winddirection", h.GetWindDirection)
-	r.Get("/api/v1/observingconditions/0/windgust", h.GetWindGust)
-	r.Get("/api/v1/observingconditions/0/windspeed", h.GetWindSpeed)
-	r.Put("/api/v1/observingconditions/0/refresh", h.PutRefresh)
-	r.Get("/api/v1/observingconditions/0/sensordescription", h.GetSensorDescription)
-	r.Get("/api/v1/observingconditions/0/timesincelastupdate", h.GetTimeSinceLastUpdate)
+	if adminAPIKey != "" {
+		r.With(middleware.APIKey(adminAPIKey, h.Unauthorized)).Get("/admin/clients", h.Clients)
+	}
+
+	r.Get("/setup", h.Setup)
+
+	r.Route("/setup/v1/observingconditions/{device_number}", func(r chi.Router) {
+		r.Use(h.ValidDevice)
+		r.Use(middleware.SameOrigin)
+
+		r.Get("/setup", h.GetDeviceSetup)
+		r.Post("/setup", h.PostDeviceSetup)
+	})
+
+	r.Route("/setup/v1/safetymonitor/{device_number}", func(r chi.Router) {
+		r.Use(h.ValidDevice)
+		r.Use(middleware.SameOrigin)
+
+		r.Get("/setup", h.GetSafetySetup)
+		r.Post("/setup", h.PostSafetySetup)
+	})
+
+	r.Route("/api/v1/observingconditions/{device_number}", func(r chi.Router) {
+		r.Use(h.ValidDevice)
+
+		r.Put("/action", h.PutAction)
+		r.Put("/commandblind", h.PutCommandBlind)
+		r.Put("/commandbool", h.PutCommandBool)
+		r.Put("/commandstring", h.PutCommandString)
+		r.Get("/connected", h.GetConnected)
+		r.Put("/connected", h.PutConnected)
+		r.Get("/description", h.GetDescription)
+		r.Get("/driverinfo", h.GetDriverInfo)
+		r.Get("/driverversion", h.GetDriverVersion)
+		r.Get("/interfaceversion", h.GetInterfaceVersion)
+		r.Get("/name", h.GetName)
+		r.Get("/supportedactions", h.GetSupportedActions)
+		r.Get("/averageperiod", h.GetAveragePeriod)
+		r.Put("/averageperiod", h.PutAveragePeriod)
+		r.Get("/cloudcover", h.GetCloudCover)
+		r.Get("/dewpoint", h.GetDewPoint)
+		r.Get("/humidity", h.GetHumidity)
+		r.Get("/pressure", h.GetPressure)
+		r.Get("/rainrate", h.GetRainRate)
+		r.Get("/skybrightness", h.GetSkyBrightness)
+		r.Get("/skyquality", h.GetSkyQuality)
+		r.Get("/skytemperature", h.GetSkyTemperature)
+		r.Get("/starfwhm", h.GetStarFWHM)
+		r.Get("/temperature", h.GetTemperature)
+		r.Get("/winddirection", h.GetWindDirection)
+		r.Get("/windgust", h.GetWindGust)
+		r.Get("/windspeed", h.GetWindSpeed)
+		r.Put("/refresh", h.PutRefresh)
+		r.Get("/sensordescription", h.GetSensorDescription)
+		r.Get("/timesincelastupdate", h.GetTimeSinceLastUpdate)
+		r.Put("/connect", h.PutConnect)
+		r.Put("/disconnect", h.PutDisconnect)
+		r.Get("/connecting", h.GetConnecting)
+		r.Get("/devicestate", h.GetDeviceState)
+	})
+
+	r.Route("/api/v1/safetymonitor/{device_number}", func(r chi.Router) {
+		r.Use(h.ValidDevice)
+
+		r.Put("/action", h.PutAction)
+		r.Put("/commandblind", h.PutCommandBlind)
+		r.Put("/commandbool", h.PutCommandBool)
+		r.Put("/commandstring", h.PutCommandString)
+		r.Get("/connected", h.GetConnected)
+		r.Put("/connected", h.PutConnected)
+		r.Get("/description", h.GetDescription)
+		r.Get("/driverinfo", h.GetDriverInfo)
+		r.Get("/driverversion", h.GetDriverVersion)
+		r.Get("/interfaceversion", h.GetInterfaceVersion)
+		r.Get("/name", h.GetName)
+		r.Get("/supportedactions", h.GetSupportedActions)
+		r.Get("/issafe", h.GetIsSafe)
+	})
+
+	r.Route("/api/v1/switch/{device_number}", func(r chi.Router) {
+		r.Use(h.ValidDevice)
+
+		r.Put("/action", h.PutAction)
+		r.Put("/commandblind", h.PutCommandBlind)
+		r.Put("/commandbool", h.PutCommandBool)
+		r.Put("/commandstring", h.PutCommandString)
+		r.Get("/connected", h.GetConnected)
+		r.Put("/connected", h.PutConnected)
+		r.Get("/description", h.GetDescription)
+		r.Get("/driverinfo", h.GetDriverInfo)
+		r.Get("/driverversion", h.GetDriverVersion)
+		r.Get("/interfaceversion", h.GetInterfaceVersion)
+		r.Get("/name", h.GetName)
+		r.Get("/supportedactions", h.GetSupportedActions)
+		r.Get("/maxswitch", h.GetMaxSwitch)
+		r.Get("/canwrite", h.GetCanWrite)
+		r.Get("/getswitch", h.GetSwitch)
+		r.Get("/getswitchdescription", h.GetSwitchDescription)
+		r.Get("/getswitchname", h.GetSwitchName)
+		r.Get("/getswitchvalue", h.GetSwitchValue)
+		r.Get("/minswitchvalue", h.GetMinSwitchValue)
+		r.Get("/maxswitchvalue", h.GetMaxSwitchValue)
+		r.Get("/switchstep", h.GetSwitchStep)
+		r.Put("/setswitch", h.PutSetSwitch)
+		r.Put("/setswitchname", h.PutSetSwitchName)
+		r.Put("/setswitchvalue", h.PutSetSwitchValue)
+	})
 
 	return r
 }
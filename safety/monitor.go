@@ -0,0 +1,255 @@
+// Package safety decides whether it is safe to observe from the current
+// weather conditions.
+package safety
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/weewx"
+)
+
+// Limit is an upper limit on a condition. Once the value rises above Max, the
+// condition stays unsafe until it falls below Max - Hysteresis. A zero Max
+// disables the limit.
+type Limit struct {
+	Max        float64 `json:"max"`
+	Hysteresis float64 `json:"hysteresis"`
+}
+
+// Rules configures when conditions are unsafe.
+type Rules struct {
+	WindSpeed  Limit `json:"wind_speed"`
+	WindGust   Limit `json:"wind_gust"`
+	Humidity   Limit `json:"humidity"`
+	CloudCover Limit `json:"cloud_cover"`
+	// UnsafeWhenRaining makes any rain rate above zero unsafe.
+	UnsafeWhenRaining bool `json:"unsafe_when_raining"`
+	// MaxAge is the age of the conditions after which they are considered
+	// stale and unsafe. Zero disables the check.
+	MaxAge time.Duration `json:"max_age"`
+	// MinSafeTime is how long the conditions must be continuously safe before
+	// the monitor reports safe.
+	MinSafeTime time.Duration `json:"min_safe_time"`
+	// MinUnsafeTime is how long the conditions must be continuously unsafe
+	// before the monitor reports unsafe.
+	MinUnsafeTime time.Duration `json:"min_unsafe_time"`
+}
+
+// Validate reports the first problem with the rules.
+func (r Rules) Validate() error {
+	limits := []struct {
+		name  string
+		limit Limit
+	}{
+		{"wind speed", r.WindSpeed},
+		{"wind gust", r.WindGust},
+		{"humidity", r.Humidity},
+		{"cloud cover", r.CloudCover},
+	}
+
+	for _, l := range limits {
+		if l.limit.Max < 0 || l.limit.Hysteresis < 0 {
+			return fmt.Errorf("%s limit and hysteresis must not be negative", l.name)
+		}
+
+		if l.limit.Max > 0 && l.limit.Hysteresis >= l.limit.Max {
+			return fmt.Errorf("%s hysteresis must be below the limit", l.name)
+		}
+	}
+
+	if r.MaxAge < 0 || r.MinSafeTime < 0 || r.MinUnsafeTime < 0 {
+		return fmt.Errorf("durations must not be negative")
+	}
+
+	return nil
+}
+
+// Monitor evaluates the rules against the current conditions at a fixed
+// interval. It starts out unsafe.
+type Monitor struct {
+	rules    Rules
+	current  func() *weewx.ObservingConditions
+	interval time.Duration
+	log      *zap.Logger
+
+	mu      sync.RWMutex
+	safe    bool
+	reasons []string
+	// tripped holds the limits currently exceeded, for the hysteresis.
+	tripped map[string]bool
+	// rawSafe is the last unfiltered result, and rawSince when it last
+	// changed.
+	rawSafe  bool
+	rawSince time.Time
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewMonitor creates a new monitor reading the conditions from current.
+func NewMonitor(rules Rules, current func() *weewx.ObservingConditions, interval time.Duration, log *zap.Logger) *Monitor {
+	return &Monitor{
+		rules:    rules,
+		current:  current,
+		interval: interval,
+		log:      log,
+		tripped:  map[string]bool{},
+		rawSince: time.Now(),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start evaluates the rules in the background.
+func (m *Monitor) Start() {
+	m.Evaluate(time.Now())
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.stop:
+				return
+			case now := <-ticker.C:
+				m.Evaluate(now)
+			}
+		}
+	}()
+}
+
+// Stop stops evaluating the rules.
+func (m *Monitor) Stop() {
+	close(m.stop)
+	m.wg.Wait()
+}
+
+// Rules returns the rules in use.
+func (m *Monitor) Rules() Rules {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.rules
+}
+
+// SetRules validates the rules and uses them from the next evaluation on.
+func (m *Monitor) SetRules(rules Rules) error {
+	err := rules.Validate()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.rules = rules
+	m.tripped = map[string]bool{}
+	m.mu.Unlock()
+
+	m.log.Info("safety rules changed")
+
+	return nil
+}
+
+// IsSafe returns the filtered safety state.
+func (m *Monitor) IsSafe() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.safe
+}
+
+// Reasons returns why the conditions are currently unsafe, if they are.
+func (m *Monitor) Reasons() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]string(nil), m.reasons...)
+}
+
+// Evaluate applies the rules to the current conditions, as of now.
+func (m *Monitor) Evaluate(now time.Time) {
+	oc := m.current()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reasons := m.check(oc, now)
+	rawSafe := len(reasons) == 0
+
+	if rawSafe != m.rawSafe {
+		m.rawSafe = rawSafe
+		m.rawSince = now
+	}
+
+	m.reasons = reasons
+
+	hold := m.rules.MinUnsafeTime
+	if rawSafe {
+		hold = m.rules.MinSafeTime
+	}
+
+	if rawSafe != m.safe && now.Sub(m.rawSince) >= hold {
+		m.safe = rawSafe
+		m.log.Info("safety changed", zap.Bool("safe", m.safe), zap.Strings("reasons", reasons))
+	}
+}
+
+func (m *Monitor) check(oc *weewx.ObservingConditions, now time.Time) []string {
+	if oc == nil || !oc.Connected {
+		return []string{"not connected"}
+	}
+
+	var reasons []string
+
+	if m.rules.MaxAge > 0 && now.Sub(oc.LastUpdated) > m.rules.MaxAge {
+		reasons = append(reasons, fmt.Sprintf("conditions older than %s", m.rules.MaxAge))
+	}
+
+	limits := []struct {
+		name  string
+		limit Limit
+		value *float64
+	}{
+		{"wind speed", m.rules.WindSpeed, oc.WindSpeed},
+		{"wind gust", m.rules.WindGust, oc.WindGust},
+		{"humidity", m.rules.Humidity, oc.Humidity},
+		{"cloud cover", m.rules.CloudCover, oc.CloudCover},
+	}
+
+	for _, l := range limits {
+		if l.limit.Max == 0 {
+			continue
+		}
+
+		if l.value == nil {
+			reasons = append(reasons, l.name+" unavailable")
+			continue
+		}
+
+		max := l.limit.Max
+		if m.tripped[l.name] {
+			max -= l.limit.Hysteresis
+		}
+
+		m.tripped[l.name] = *l.value > max
+		if m.tripped[l.name] {
+			reasons = append(reasons, fmt.Sprintf("%s %.1f above %.1f", l.name, *l.value, max))
+		}
+	}
+
+	if m.rules.UnsafeWhenRaining {
+		if oc.RainRate == nil {
+			reasons = append(reasons, "rain rate unavailable")
+		} else if *oc.RainRate > 0 {
+			reasons = append(reasons, "raining")
+		}
+	}
+
+	return reasons
+}
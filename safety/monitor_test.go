@@ -0,0 +1,168 @@
+package safety
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/weewx"
+)
+
+func TestMonitorEvaluate(t *testing.T) {
+	start := time.Now()
+
+	// conditions returns connected conditions updated at start.
+	conditions := func(humidity, rainRate float64) *weewx.ObservingConditions {
+		return &weewx.ObservingConditions{
+			Connected:   true,
+			Humidity:    &humidity,
+			RainRate:    &rainRate,
+			LastUpdated: start,
+		}
+	}
+
+	type step struct {
+		at   time.Duration
+		oc   *weewx.ObservingConditions
+		safe bool
+	}
+
+	humidity := Rules{Humidity: Limit{Max: 90, Hysteresis: 5}}
+
+	tests := []struct {
+		name  string
+		rules Rules
+		steps []step
+	}{
+		{
+			name: "safe without hold times",
+			steps: []step{
+				{0, conditions(50, 0), true},
+			},
+		},
+		{
+			name: "not connected",
+			steps: []step{
+				{0, nil, false},
+				{time.Minute, &weewx.ObservingConditions{}, false},
+				{2 * time.Minute, conditions(50, 0), true},
+			},
+		},
+		{
+			name:  "hysteresis",
+			rules: humidity,
+			steps: []step{
+				{0, conditions(80, 0), true},
+				{1 * time.Minute, conditions(90, 0), true},
+				{2 * time.Minute, conditions(91, 0), false},
+				{3 * time.Minute, conditions(88, 0), false},
+				{4 * time.Minute, conditions(86, 0), false},
+				{5 * time.Minute, conditions(84, 0), true},
+				{6 * time.Minute, conditions(88, 0), true},
+			},
+		},
+		{
+			name:  "unavailable value",
+			rules: humidity,
+			steps: []step{
+				{0, &weewx.ObservingConditions{Connected: true, LastUpdated: start}, false},
+			},
+		},
+		{
+			name:  "rain",
+			rules: Rules{UnsafeWhenRaining: true},
+			steps: []step{
+				{0, conditions(50, 0), true},
+				{time.Minute, conditions(50, 0.2), false},
+				{2 * time.Minute, conditions(50, 0), true},
+			},
+		},
+		{
+			name:  "stale conditions",
+			rules: Rules{MaxAge: 10 * time.Minute},
+			steps: []step{
+				{5 * time.Minute, conditions(50, 0), true},
+				{10 * time.Minute, conditions(50, 0), true},
+				{11 * time.Minute, conditions(50, 0), false},
+			},
+		},
+		{
+			name:  "unsafe at startup until safe for the minimum time",
+			rules: Rules{Humidity: humidity.Humidity, MinSafeTime: 10 * time.Minute},
+			steps: []step{
+				{0, conditions(50, 0), false},
+				{5 * time.Minute, conditions(50, 0), false},
+				{10 * time.Minute, conditions(50, 0), true},
+			},
+		},
+		{
+			name:  "unsafe spell restarts the minimum safe time",
+			rules: Rules{Humidity: humidity.Humidity, MinSafeTime: 10 * time.Minute},
+			steps: []step{
+				{0, conditions(50, 0), false},
+				{5 * time.Minute, conditions(95, 0), false},
+				{6 * time.Minute, conditions(50, 0), false},
+				{15 * time.Minute, conditions(50, 0), false},
+				{16 * time.Minute, conditions(50, 0), true},
+			},
+		},
+		{
+			name:  "minimum unsafe time",
+			rules: Rules{Humidity: humidity.Humidity, MinUnsafeTime: 5 * time.Minute},
+			steps: []step{
+				{0, conditions(50, 0), true},
+				{1 * time.Minute, conditions(95, 0), true},
+				{2 * time.Minute, conditions(50, 0), true},
+				{3 * time.Minute, conditions(95, 0), true},
+				{7 * time.Minute, conditions(95, 0), true},
+				{8 * time.Minute, conditions(95, 0), false},
+				{9 * time.Minute, conditions(50, 0), true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var oc *weewx.ObservingConditions
+
+			m := NewMonitor(tt.rules, func() *weewx.ObservingConditions { return oc }, time.Minute, zap.NewNop())
+			if m.IsSafe() {
+				t.Fatal("safe before the first evaluation")
+			}
+
+			for _, s := range tt.steps {
+				oc = s.oc
+				m.Evaluate(start.Add(s.at))
+
+				if m.IsSafe() != s.safe {
+					t.Errorf("at %s: safe %t, want %t (reasons %q)", s.at, m.IsSafe(), s.safe, m.Reasons())
+				}
+			}
+		})
+	}
+}
+
+func TestSetRulesResetsHysteresis(t *testing.T) {
+	humidity := 88.0
+	oc := &weewx.ObservingConditions{Connected: true, Humidity: &humidity, LastUpdated: time.Now()}
+
+	rules := Rules{Humidity: Limit{Max: 85, Hysteresis: 5}}
+
+	m := NewMonitor(rules, func() *weewx.ObservingConditions { return oc }, time.Minute, zap.NewNop())
+	m.Evaluate(time.Now())
+	if m.IsSafe() {
+		t.Fatal("safe with humidity above the limit")
+	}
+
+	rules.Humidity.Max = 90
+	err := m.SetRules(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.Evaluate(time.Now())
+	if !m.IsSafe() {
+		t.Errorf("unsafe below the new limit, reasons %q", m.Reasons())
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http/httptest"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/conformance"
+)
+
+// runSelfTest runs the Alpaca conformance checks against a running server,
+// or against an in-process server with a fake source when no URL is given.
+func runSelfTest(args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	url := fs.String("url", "", "address of a running server such as http://localhost:8080, empty to test an in-process server")
+	deviceNumber := fs.Int("device", 0, "ObservingConditions device number to check")
+	verbose := fs.Bool("v", false, "print passing checks too")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	baseURL := *url
+	if baseURL == "" {
+		srv := httptest.NewServer(conformance.NewFakeServer())
+		defer srv.Close()
+
+		baseURL = srv.URL
+	}
+
+	results := conformance.Run(conformance.Options{
+		BaseURL:      baseURL,
+		DeviceNumber: *deviceNumber,
+	})
+
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Printf("FAIL\t%s: %v\n", r.Name, r.Err)
+		} else if *verbose {
+			fmt.Printf("ok\t%s\n", r.Name)
+		}
+	}
+
+	failed := conformance.Failed(results)
+	fmt.Printf("%d checks, %d failed\n", len(results), failed)
+
+	if failed > 0 {
+		return fmt.Errorf("%d conformance checks failed", failed)
+	}
+
+	return nil
+}
@@ -6,8 +6,6 @@ package server
 import (
 	"context"
 	"net"
-	"os"
-	"os/signal"
 	"time"
 
 	"go.uber.org/zap"
@@ -38,38 +36,30 @@ func NewGracefulHTTPServer(log *zap.Logger, svr HTTPServer, l net.Listener, time
 	}
 }
 
-// Run starts the http server, waiting for a SIGINT signal to
-// the process. Once it has received one of those, or if it fails to start at all,
-// the function will return. If we are shutting down due to a signal, we call
-// Shutdown on the http.Server we are using. This function will wait for existing
-// requests to be completed before returning. We only wait up to 30 seconds to
-// do the graceful shutdown. After that, we just kill the connections.
-func (s *GracefulHTTPServer) Run() error {
+// Run starts the http server and serves until ctx is done or the server fails.
+// Once ctx is done, we call Shutdown on the http.Server we are using. This
+// function will wait for existing requests to be completed before returning.
+// We only wait up to the timeout to do the graceful shutdown. After that, we
+// just kill the connections.
+func (s *GracefulHTTPServer) Run(ctx context.Context) error {
 	errs := make(chan error, 1)
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
 
 	go func() {
-		err := s.svr.Serve(s.l)
-		if err != nil {
-			errs <- err
-		}
+		errs <- s.svr.Serve(s.l)
 	}()
 
 	// This select statement will block until we can read from EITHER our errs
-	// channel or the stop channel. The stop channel will get a value when we get
-	// a SIGINT signal. The errs channel will get a value if we failed
-	// to start the server.
+	// channel or the context. The errs channel will get a value if the server
+	// failed.
 	select {
 	case err := <-errs:
-		s.log.Error("")
 		return err
-	case sig := <-stop:
-		s.log.Info("server shutdown request received", zap.String("signal", sig.String()))
+	case <-ctx.Done():
+		s.log.Info("server shutdown request received")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
-	err := s.svr.Shutdown(ctx)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	err := s.svr.Shutdown(shutdownCtx)
 	cancel() // Cancel the timeout, since we already finished.
 
 	return err
@@ -0,0 +1,147 @@
+// Package settings persists the settings changed from the setup pages, so
+// that they survive a restart.
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/safety"
+	"github.com/darkdragonsastro/weewx-json-alpaca/weewx"
+)
+
+// Settings are the saved settings. Devices are keyed by their unique ID, so
+// that they stay attached to the right device when devices are added.
+type Settings struct {
+	// ID identifies the server. It is generated on first use.
+	ID      string                    `json:"id,omitempty"`
+	Devices map[string]weewx.Settings `json:"devices,omitempty"`
+	Safety  *safety.Rules             `json:"safety,omitempty"`
+}
+
+// Store holds the settings and writes them to a JSON file whenever they
+// change.
+type Store struct {
+	path string
+
+	mu       sync.Mutex
+	settings Settings
+}
+
+// Load reads the settings from path. A missing file is not an error; the
+// store then starts out empty.
+func Load(path string) (*Store, error) {
+	s := &Store{
+		path: path,
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &s.settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Path returns the file the settings are saved to.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// ID returns the unique ID of the server, generating and saving one the first
+// time.
+func (s *Store) ID() (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.settings.ID != "" {
+		return uuid.Parse(s.settings.ID)
+	}
+
+	id := uuid.New()
+	s.settings.ID = id.String()
+
+	return id, s.save()
+}
+
+// Device returns the saved settings of the device, if there are any.
+func (s *Store) Device(uniqueID string) (weewx.Settings, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.settings.Devices[uniqueID]
+	return d, ok
+}
+
+// SetDevice saves the settings of the device.
+func (s *Store) SetDevice(uniqueID string, d weewx.Settings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.settings.Devices == nil {
+		s.settings.Devices = make(map[string]weewx.Settings)
+	}
+
+	s.settings.Devices[uniqueID] = d
+
+	return s.save()
+}
+
+// Safety returns the saved safety rules, if there are any.
+func (s *Store) Safety() (safety.Rules, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.settings.Safety == nil {
+		return safety.Rules{}, false
+	}
+
+	return *s.settings.Safety, true
+}
+
+// SetSafety saves the safety rules.
+func (s *Store) SetSafety(rules safety.Rules) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.settings.Safety = &rules
+
+	return s.save()
+}
+
+// save writes the settings to a temporary file and renames it into place, so
+// that a crash never leaves a partial file behind.
+func (s *Store) save() error {
+	b, err := json.MarshalIndent(s.settings, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+
+	err = os.WriteFile(tmp, b, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
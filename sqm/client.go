@@ -0,0 +1,135 @@
+// Package sqm reads sky quality from a Unihedron SQM-LE over its TCP
+// interface.
+package sqm
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPort is the TCP port the SQM-LE listens on.
+const DefaultPort = 10001
+
+// Reading is the response to an "rx" request.
+type Reading struct {
+	// Magnitude is the sky quality in mag/arcsec².
+	Magnitude float64
+	// Frequency is the sensor frequency in Hz.
+	Frequency float64
+	// Count is the sensor period in counts.
+	Count float64
+	// Period is the sensor period in seconds.
+	Period float64
+	// Temperature is the sensor temperature in °C.
+	Temperature float64
+}
+
+// Client talks to a single SQM-LE.
+type Client struct {
+	addr    string
+	timeout time.Duration
+}
+
+// NewClient creates a new client for the SQM-LE at the given host:port
+// address. If no port is given, DefaultPort is used.
+func NewClient(addr string) *Client {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, strconv.Itoa(DefaultPort))
+	}
+
+	return &Client{
+		addr:    addr,
+		timeout: 5 * time.Second,
+	}
+}
+
+// Read requests a new reading from the meter.
+func (c *Client) Read() (*Reading, error) {
+	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(c.timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.Write([]byte("rx"))
+	if err != nil {
+		return nil, err
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseReading(line)
+}
+
+// SkyQuality returns the current sky quality in mag/arcsec².
+func (c *Client) SkyQuality() (float64, error) {
+	reading, err := c.Read()
+	if err != nil {
+		return 0, err
+	}
+
+	return reading.Magnitude, nil
+}
+
+// ParseReading parses an "rx" response line such as
+//
+//	r, 19.29m,0000005915Hz,0000000000c,0000000.000s, 027.0C
+func ParseReading(line string) (*Reading, error) {
+	fields := strings.Split(strings.TrimSpace(line), ",")
+	if len(fields) != 6 || strings.TrimSpace(fields[0]) != "r" {
+		return nil, fmt.Errorf("unexpected sqm response %q", line)
+	}
+
+	values := make([]float64, 5)
+	suffixes := []string{"m", "Hz", "c", "s", "C"}
+
+	for i, suffix := range suffixes {
+		field := strings.TrimSpace(fields[i+1])
+		if !strings.HasSuffix(field, suffix) {
+			return nil, fmt.Errorf("unexpected sqm field %q", field)
+		}
+
+		v, err := strconv.ParseFloat(strings.TrimSuffix(field, suffix), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sqm field %q: %w", field, err)
+		}
+
+		values[i] = v
+	}
+
+	return &Reading{
+		Magnitude:   values[0],
+		Frequency:   values[1],
+		Count:       values[2],
+		Period:      values[3],
+		Temperature: values[4],
+	}, nil
+}
+
+// FormatReading formats the reading the way the SQM-LE answers an "rx"
+// request, including the trailing CRLF.
+func FormatReading(r Reading) string {
+	return fmt.Sprintf("r,% 06.2fm,%010.0fHz,%010.0fc,%011.3fs,% 06.1fC\r\n",
+		r.Magnitude, r.Frequency, r.Count, r.Period, r.Temperature)
+}
+
+// Lux converts a sky quality in mag/arcsec² to the illuminance in lux of a
+// uniformly bright sky of that luminance.
+func Lux(magnitude float64) float64 {
+	candelas := 10.8e4 * math.Pow(10, -0.4*magnitude)
+
+	return math.Pi * candelas
+}
@@ -0,0 +1,79 @@
+package sqm
+
+import (
+	"math"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestClientReadsSimulator(t *testing.T) {
+	sim := NewSimulator(zap.NewNop(), Reading{
+		Magnitude:   20.0,
+		Frequency:   5915,
+		Count:       0,
+		Period:      0,
+		Temperature: 27,
+	})
+
+	err := sim.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Stop()
+
+	c := NewClient(sim.Addr())
+
+	reading, err := c.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reading.Magnitude != 20.0 || reading.Frequency != 5915 || reading.Temperature != 27 {
+		t.Errorf("reading %+v does not match the simulator", reading)
+	}
+
+	sim.SetReading(Reading{Magnitude: 21.5, Temperature: -3.5})
+
+	skyQuality, err := c.SkyQuality()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if skyQuality != 21.5 {
+		t.Errorf("sky quality %g, want 21.5", skyQuality)
+	}
+}
+
+func TestLux(t *testing.T) {
+	// 20 mag/arcsec² is 1.08e-3 cd/m², which lights a surface with π times
+	// that in lux.
+	want := 1.08e-3 * math.Pi
+
+	if got := Lux(20); math.Abs(got-want) > 1e-9 {
+		t.Errorf("Lux(20) = %g, want %g", got, want)
+	}
+
+	// Each magnitude is 2.512 times darker.
+	if ratio := Lux(20) / Lux(21); math.Abs(ratio-math.Pow(10, 0.4)) > 1e-9 {
+		t.Errorf("Lux(20)/Lux(21) = %g, want %g", ratio, math.Pow(10, 0.4))
+	}
+}
+
+func TestParseReading(t *testing.T) {
+	r, err := ParseReading("r, 19.29m,0000005915Hz,0000000000c,0000000.000s, 027.0C\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Magnitude != 19.29 || r.Frequency != 5915 || r.Temperature != 27 {
+		t.Errorf("parsed %+v", r)
+	}
+
+	for _, line := range []string{"", "x, 19.29m,0Hz,0c,0s,0C", "r, 19.29,0Hz,0c,0s,0C", "r, abcm,0Hz,0c,0s,0C"} {
+		_, err := ParseReading(line)
+		if err == nil {
+			t.Errorf("ParseReading(%q) succeeded", line)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package sqm
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// Simulator is a local stand-in for an SQM-LE. It answers "rx" requests with
+// a configurable reading and is used to test the client without hardware.
+type Simulator struct {
+	log     *zap.Logger
+	reading atomic.Value
+
+	l  net.Listener
+	wg sync.WaitGroup
+}
+
+// NewSimulator creates a simulator that reports the given reading.
+func NewSimulator(log *zap.Logger, reading Reading) *Simulator {
+	s := &Simulator{
+		log: log,
+	}
+	s.reading.Store(reading)
+
+	return s
+}
+
+// SetReading changes the reading returned for subsequent requests.
+func (s *Simulator) SetReading(reading Reading) {
+	s.reading.Store(reading)
+}
+
+// Start listens on the given address and serves requests in the background.
+// Use ":0" to pick a free port, then Addr to find it.
+func (s *Simulator) Start(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.l = l
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+
+	return nil
+}
+
+// Addr returns the address the simulator is listening on.
+func (s *Simulator) Addr() string {
+	return s.l.Addr().String()
+}
+
+// Stop closes the listener and waits for open connections to finish.
+func (s *Simulator) Stop() {
+	s.l.Close()
+	s.wg.Wait()
+}
+
+func (s *Simulator) serve(conn net.Conn) {
+	defer conn.Close()
+
+	rd := bufio.NewReader(conn)
+	buf := make([]byte, 2)
+
+	for {
+		_, err := rd.Read(buf[:1])
+		if err != nil {
+			return
+		}
+
+		if buf[0] != 'r' {
+			continue
+		}
+
+		_, err = rd.Read(buf[1:])
+		if err != nil {
+			return
+		}
+
+		if buf[1] != 'x' {
+			continue
+		}
+
+		reading := s.reading.Load().(Reading)
+		s.log.Info("sqm simulator request", zap.Float64("magnitude", reading.Magnitude))
+
+		_, err = conn.Write([]byte(FormatReading(reading)))
+		if err != nil {
+			return
+		}
+	}
+}
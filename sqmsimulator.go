@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+
+	"go.uber.org/zap"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/sqm"
+)
+
+// runSQMSimulator serves a simulated SQM-LE until interrupted.
+func runSQMSimulator(log *zap.Logger, args []string) error {
+	fs := flag.NewFlagSet("sqm-simulator", flag.ContinueOnError)
+	addr := fs.String("addr", ":10001", "address to listen on")
+	magnitude := fs.Float64("magnitude", 20.5, "sky quality to report in mag/arcsec²")
+	temperature := fs.Float64("temperature", 10, "sensor temperature to report in °C")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	s := sqm.NewSimulator(log, sqm.Reading{
+		Magnitude:   *magnitude,
+		Frequency:   5915,
+		Temperature: *temperature,
+	})
+
+	err = s.Start(*addr)
+	if err != nil {
+		return err
+	}
+
+	log.Info("sqm simulator listening", zap.String("addr", s.Addr()))
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	<-stop
+
+	s.Stop()
+
+	return nil
+}
@@ -0,0 +1,186 @@
+// Package stars detects stars in images and measures their FWHM by fitting
+// Gaussian profiles.
+package stars
+
+//go:generate go run testdata/generate.go
+
+import (
+	"math"
+	"sort"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/fits"
+)
+
+// fwhmPerSigma converts the sigma of a Gaussian to its FWHM.
+const fwhmPerSigma = 2.3548200450309493
+
+// Options controls star detection.
+type Options struct {
+	// Threshold is the detection threshold in standard deviations of the
+	// background noise.
+	Threshold float64
+	// Radius is the half size in pixels of the box fitted around each star.
+	Radius int
+	// MaxStars limits how many of the brightest stars are fitted.
+	MaxStars int
+	// Saturation is the pixel value above which stars are ignored. Zero
+	// disables the check.
+	Saturation float64
+}
+
+// DefaultOptions returns the options used when none are configured.
+func DefaultOptions() Options {
+	return Options{
+		Threshold: 5,
+		Radius:    7,
+		MaxStars:  200,
+	}
+}
+
+// Star is a star detected in an image.
+type Star struct {
+	// X and Y are the fitted center in pixels.
+	X float64
+	Y float64
+	// Amplitude is the fitted peak above the background.
+	Amplitude float64
+	// FWHM is the fitted full width at half maximum in pixels.
+	FWHM float64
+}
+
+// Background estimates the sky background and its noise from the median and
+// the median absolute deviation of the pixels.
+func Background(pixels []float64) (level, sigma float64) {
+	// Sample large images to keep this fast.
+	step := len(pixels)/100000 + 1
+
+	sample := make([]float64, 0, len(pixels)/step+1)
+	for i := 0; i < len(pixels); i += step {
+		sample = append(sample, pixels[i])
+	}
+
+	level = median(sample)
+
+	for i, v := range sample {
+		sample[i] = math.Abs(v - level)
+	}
+
+	sigma = 1.4826 * median(sample)
+
+	return level, sigma
+}
+
+// Peaks returns the local maxima above the detection threshold, brightest
+// first. Peaks closer than the radius to a brighter peak are dropped, so
+// blended stars do not count twice.
+func Peaks(img *fits.Image, opts Options) []Star {
+	level, sigma := Background(img.Pixels)
+	threshold := level + opts.Threshold*math.Max(sigma, 1e-9)
+
+	r := opts.Radius
+
+	var peaks []Star
+	for y := r; y < img.Height-r; y++ {
+		for x := r; x < img.Width-r; x++ {
+			v := img.At(x, y)
+			if v <= threshold || (opts.Saturation > 0 && v >= opts.Saturation) {
+				continue
+			}
+
+			if !isLocalMax(img, x, y) {
+				continue
+			}
+
+			peaks = append(peaks, Star{X: float64(x), Y: float64(y), Amplitude: v - level})
+		}
+	}
+
+	sort.Slice(peaks, func(i, j int) bool { return peaks[i].Amplitude > peaks[j].Amplitude })
+
+	var kept []Star
+	for _, p := range peaks {
+		isolated := true
+		for _, k := range kept {
+			if math.Abs(p.X-k.X) <= float64(r) && math.Abs(p.Y-k.Y) <= float64(r) {
+				isolated = false
+				break
+			}
+		}
+
+		if isolated {
+			kept = append(kept, p)
+		}
+	}
+
+	return kept
+}
+
+func isLocalMax(img *fits.Image, x, y int) bool {
+	v := img.At(x, y)
+
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if dx == 0 && dy == 0 {
+				continue
+			}
+
+			n := img.At(x+dx, y+dy)
+			// Break ties towards the bottom left so flat tops give one peak.
+			if n > v || (n == v && (dy < 0 || (dy == 0 && dx < 0))) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Detect finds the stars in the image and fits a circular Gaussian to each.
+// Stars where the fit does not converge to a plausible profile are dropped.
+func Detect(img *fits.Image, opts Options) []Star {
+	peaks := Peaks(img, opts)
+	if opts.MaxStars > 0 && len(peaks) > opts.MaxStars {
+		peaks = peaks[:opts.MaxStars]
+	}
+
+	var stars []Star
+	for _, p := range peaks {
+		s, ok := fitGaussian(img, int(p.X), int(p.Y), opts.Radius)
+		if ok {
+			stars = append(stars, s)
+		}
+	}
+
+	return stars
+}
+
+// MedianFWHM returns the median FWHM in pixels of the stars in the image, and
+// the number of stars measured. It returns false when no star was measured.
+func MedianFWHM(img *fits.Image, opts Options) (float64, int, bool) {
+	stars := Detect(img, opts)
+	if len(stars) == 0 {
+		return 0, 0, false
+	}
+
+	fwhms := make([]float64, len(stars))
+	for i, s := range stars {
+		fwhms[i] = s.FWHM
+	}
+
+	return median(fwhms), len(stars), true
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sort.Float64s(values)
+
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+
+	return (values[n/2-1] + values[n/2]) / 2
+}
@@ -0,0 +1,172 @@
+package stars
+
+import (
+	"math"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/fits"
+)
+
+// fitGaussian fits a circular Gaussian with a constant background to the box
+// of the given radius around cx, cy using the Levenberg-Marquardt method.
+//
+// The model is b + a*exp(-((x-x0)² + (y-y0)²) / (2s²)), with the parameters
+// held in p as [a, x0, y0, s, b].
+func fitGaussian(img *fits.Image, cx, cy, radius int) (Star, bool) {
+	var xs, ys, vs []float64
+
+	minV, maxV := math.Inf(1), math.Inf(-1)
+	for y := cy - radius; y <= cy+radius; y++ {
+		for x := cx - radius; x <= cx+radius; x++ {
+			v := img.At(x, y)
+			xs = append(xs, float64(x))
+			ys = append(ys, float64(y))
+			vs = append(vs, v)
+
+			minV = math.Min(minV, v)
+			maxV = math.Max(maxV, v)
+		}
+	}
+
+	p := [5]float64{maxV - minV, float64(cx), float64(cy), 1.5, minV}
+
+	residuals := func(p [5]float64) float64 {
+		sum := 0.0
+		for i := range vs {
+			d := vs[i] - model(p, xs[i], ys[i])
+			sum += d * d
+		}
+		return sum
+	}
+
+	lambda := 1e-3
+	cost := residuals(p)
+
+	for iter := 0; iter < 100; iter++ {
+		var jtj [5][5]float64
+		var jtr [5]float64
+
+		for i := range vs {
+			j := jacobian(p, xs[i], ys[i])
+			r := vs[i] - model(p, xs[i], ys[i])
+
+			for a := 0; a < 5; a++ {
+				jtr[a] += j[a] * r
+				for b := 0; b < 5; b++ {
+					jtj[a][b] += j[a] * j[b]
+				}
+			}
+		}
+
+		improved := false
+		for !improved && lambda < 1e10 {
+			var m [5][5]float64
+			for a := 0; a < 5; a++ {
+				m[a] = jtj[a]
+				m[a][a] *= 1 + lambda
+			}
+
+			delta, ok := solve(m, jtr)
+			if !ok {
+				lambda *= 10
+				continue
+			}
+
+			var next [5]float64
+			for a := range p {
+				next[a] = p[a] + delta[a]
+			}
+			next[3] = math.Abs(next[3])
+
+			nextCost := residuals(next)
+			if nextCost < cost {
+				converged := (cost-nextCost)/cost < 1e-9
+				p, cost = next, nextCost
+				lambda /= 10
+				improved = true
+
+				if converged {
+					iter = 100
+				}
+			} else {
+				lambda *= 10
+			}
+		}
+
+		if !improved {
+			break
+		}
+	}
+
+	star := Star{
+		X:         p[1],
+		Y:         p[2],
+		Amplitude: p[0],
+		FWHM:      fwhmPerSigma * p[3],
+	}
+
+	// Reject fits that wandered off the star or are not star shaped.
+	ok := p[0] > 0 &&
+		math.Abs(p[1]-float64(cx)) <= 2 && math.Abs(p[2]-float64(cy)) <= 2 &&
+		p[3] > 0.3 && p[3] < float64(radius)/2
+
+	return star, ok
+}
+
+func model(p [5]float64, x, y float64) float64 {
+	dx, dy := x-p[1], y-p[2]
+	return p[4] + p[0]*math.Exp(-(dx*dx+dy*dy)/(2*p[3]*p[3]))
+}
+
+func jacobian(p [5]float64, x, y float64) [5]float64 {
+	dx, dy := x-p[1], y-p[2]
+	s2 := p[3] * p[3]
+	e := math.Exp(-(dx*dx + dy*dy) / (2 * s2))
+
+	return [5]float64{
+		e,
+		p[0] * e * dx / s2,
+		p[0] * e * dy / s2,
+		p[0] * e * (dx*dx + dy*dy) / (s2 * p[3]),
+		1,
+	}
+}
+
+// solve solves m·x = v by Gaussian elimination with partial pivoting.
+func solve(m [5][5]float64, v [5]float64) ([5]float64, bool) {
+	const n = 5
+
+	for c := 0; c < n; c++ {
+		pivot := c
+		for r := c + 1; r < n; r++ {
+			if math.Abs(m[r][c]) > math.Abs(m[pivot][c]) {
+				pivot = r
+			}
+		}
+
+		if math.Abs(m[pivot][c]) < 1e-12 {
+			return v, false
+		}
+
+		m[c], m[pivot] = m[pivot], m[c]
+		v[c], v[pivot] = v[pivot], v[c]
+
+		for r := c + 1; r < n; r++ {
+			f := m[r][c] / m[c][c]
+			for k := c; k < n; k++ {
+				m[r][k] -= f * m[c][k]
+			}
+			v[r] -= f * v[c]
+		}
+	}
+
+	var x [5]float64
+	for r := n - 1; r >= 0; r-- {
+		sum := v[r]
+		for k := r + 1; k < n; k++ {
+			sum -= m[r][k] * x[k]
+		}
+		x[r] = sum / m[r][r]
+	}
+
+	return x, true
+}
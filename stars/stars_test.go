@@ -0,0 +1,47 @@
+package stars
+
+import (
+	"math"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/fits"
+)
+
+func TestMedianFWHMOfSyntheticImages(t *testing.T) {
+	paths, err := filepath.Glob("testdata/*.fits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no test images")
+	}
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			img, err := fits.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want, err := strconv.ParseFloat(img.Header["SYNFWHM"], 64)
+			if err != nil {
+				t.Fatalf("invalid SYNFWHM header %q", img.Header["SYNFWHM"])
+			}
+
+			fwhm, n, ok := MedianFWHM(img, DefaultOptions())
+			if !ok {
+				t.Fatal("no star measured")
+			}
+
+			if n < 10 {
+				t.Errorf("measured %d stars, want at least 10", n)
+			}
+
+			if math.Abs(fwhm-want) > 0.05*want {
+				t.Errorf("median FWHM %.3f, want %.2f within 5%%", fwhm, want)
+			}
+		})
+	}
+}
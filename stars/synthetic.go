@@ -0,0 +1,61 @@
+package stars
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/fits"
+)
+
+// SyntheticOptions describes a synthetic star field.
+type SyntheticOptions struct {
+	Width  int
+	Height int
+	// Stars is the number of stars to place.
+	Stars int
+	// FWHM is the FWHM of every star in pixels.
+	FWHM float64
+	// Background is the sky level.
+	Background float64
+	// Noise is the standard deviation of the Gaussian noise added to every
+	// pixel.
+	Noise float64
+	// Seed makes the field reproducible.
+	Seed int64
+}
+
+// Synthesize renders a star field of Gaussian stars with a known FWHM. It is
+// used to produce test images for the FWHM measurement.
+func Synthesize(opts SyntheticOptions) *fits.Image {
+	rnd := rand.New(rand.NewSource(opts.Seed))
+
+	img := &fits.Image{
+		Width:  opts.Width,
+		Height: opts.Height,
+		Pixels: make([]float64, opts.Width*opts.Height),
+		Header: map[string]string{},
+	}
+
+	for i := range img.Pixels {
+		img.Pixels[i] = opts.Background + rnd.NormFloat64()*opts.Noise
+	}
+
+	sigma := opts.FWHM / fwhmPerSigma
+	reach := int(math.Ceil(5 * sigma))
+	margin := float64(reach + 2)
+
+	for s := 0; s < opts.Stars; s++ {
+		x0 := margin + rnd.Float64()*(float64(opts.Width)-2*margin)
+		y0 := margin + rnd.Float64()*(float64(opts.Height)-2*margin)
+		amplitude := 1000 + rnd.Float64()*20000
+
+		for y := int(y0) - reach; y <= int(y0)+reach; y++ {
+			for x := int(x0) - reach; x <= int(x0)+reach; x++ {
+				dx, dy := float64(x)-x0, float64(y)-y0
+				img.Pixels[y*opts.Width+x] += amplitude * math.Exp(-(dx*dx+dy*dy)/(2*sigma*sigma))
+			}
+		}
+	}
+
+	return img
+}
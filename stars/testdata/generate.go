@@ -0,0 +1,42 @@
+//go:build ignore
+
+// This program generates the synthetic star fields in testdata. Run it with
+// go generate from the stars package. Each
+// field has stars of a single, known FWHM recorded in the SYNFWHM header.
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/fits"
+	"github.com/darkdragonsastro/weewx-json-alpaca/stars"
+)
+
+func main() {
+	for i, fwhm := range []float64{2.5, 4.0} {
+		img := stars.Synthesize(stars.SyntheticOptions{
+			Width:      256,
+			Height:     256,
+			Stars:      40,
+			FWHM:       fwhm,
+			Background: 1000,
+			Noise:      20,
+			Seed:       int64(i + 1),
+		})
+
+		img.Header["SYNFWHM"] = strconv.FormatFloat(fwhm, 'f', 2, 64)
+		img.Header["PIXSCALE"] = "1.5"
+		img.Header["FILTER"] = "L"
+		img.Header["EXPTIME"] = "60"
+		img.Header["DATE-OBS"] = "2023-10-13T22:55:00"
+
+		path := fmt.Sprintf("testdata/synthetic-fwhm-%.1f.fits", fwhm)
+
+		err := fits.WriteFile(path, img)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
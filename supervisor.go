@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// supervisor stops the running parts of the server in the reverse of the order
+// they were started in, so that nothing is stopped while something started
+// after it still uses it.
+type supervisor struct {
+	log     *zap.Logger
+	timeout time.Duration
+
+	components []component
+}
+
+type component struct {
+	name string
+	stop func()
+}
+
+func newSupervisor(log *zap.Logger, timeout time.Duration) *supervisor {
+	return &supervisor{
+		log:     log,
+		timeout: timeout,
+	}
+}
+
+// started registers a running component and how to stop it.
+func (s *supervisor) started(name string, stop func()) {
+	s.components = append(s.components, component{name: name, stop: stop})
+}
+
+// shutdown stops every component. It gives up once the timeout has passed,
+// reporting the component that did not stop in time.
+func (s *supervisor) shutdown() error {
+	deadline := time.NewTimer(s.timeout)
+	defer deadline.Stop()
+
+	for i := len(s.components) - 1; i >= 0; i-- {
+		c := s.components[i]
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.stop()
+		}()
+
+		select {
+		case <-done:
+			s.log.Debug("stopped", zap.String("component", c.name))
+		case <-deadline.C:
+			return fmt.Errorf("%s did not stop within %s", c.name, s.timeout)
+		}
+	}
+
+	s.components = nil
+
+	return nil
+}
@@ -0,0 +1,183 @@
+// Package switches exposes the observing conditions as read-only ASCOM
+// switches: boolean switches for conditions such as "Raining", and analog
+// switches that mirror a sensor value.
+package switches
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darkdragonsastro/weewx-json-alpaca/weewx"
+)
+
+// Switch is a single read-only switch.
+type Switch struct {
+	Name        string
+	Description string
+	Min         float64
+	Max         float64
+	Step        float64
+	// Value returns the switch value, or nil if the conditions needed are not
+	// available.
+	Value func(oc *weewx.ObservingConditions, now time.Time) *float64
+}
+
+// Boolean reports whether the switch is an on/off switch.
+func (s *Switch) Boolean() bool {
+	return s.Min == 0 && s.Max == 1 && s.Step == 1
+}
+
+// sensor describes a value that switches can be built on.
+type sensor struct {
+	unit  string
+	min   float64
+	max   float64
+	step  float64
+	value func(oc *weewx.ObservingConditions, now time.Time) *float64
+}
+
+func field(f func(oc *weewx.ObservingConditions) *float64) func(*weewx.ObservingConditions, time.Time) *float64 {
+	return func(oc *weewx.ObservingConditions, _ time.Time) *float64 {
+		return f(oc)
+	}
+}
+
+var sensors = map[string]sensor{
+	"cloudcover":     {"%", 0, 100, 0.1, field(func(oc *weewx.ObservingConditions) *float64 { return oc.CloudCover })},
+	"dewpoint":       {"°C", -50, 50, 0.1, field(func(oc *weewx.ObservingConditions) *float64 { return oc.DewPoint })},
+	"humidity":       {"%", 0, 100, 0.1, field(func(oc *weewx.ObservingConditions) *float64 { return oc.Humidity })},
+	"pressure":       {"hPa", 800, 1100, 0.1, field(func(oc *weewx.ObservingConditions) *float64 { return oc.Pressure })},
+	"rainrate":       {"mm/h", 0, 500, 0.1, field(func(oc *weewx.ObservingConditions) *float64 { return oc.RainRate })},
+	"skybrightness":  {"lux", 0, 100000, 0.0001, field(func(oc *weewx.ObservingConditions) *float64 { return oc.SkyBrightness })},
+	"skyquality":     {"mag/arcsec²", 0, 25, 0.01, field(func(oc *weewx.ObservingConditions) *float64 { return oc.SkyQuality })},
+	"skytemperature": {"°C", -80, 50, 0.1, field(func(oc *weewx.ObservingConditions) *float64 { return oc.SkyTemperature })},
+	"temperature":    {"°C", -50, 60, 0.1, field(func(oc *weewx.ObservingConditions) *float64 { return oc.Temperature })},
+	"winddirection":  {"°", 0, 360, 1, field(func(oc *weewx.ObservingConditions) *float64 { return oc.WindDirection })},
+	"windgust":       {"km/h", 0, 250, 0.1, field(func(oc *weewx.ObservingConditions) *float64 { return oc.WindGust })},
+	"windspeed":      {"km/h", 0, 250, 0.1, field(func(oc *weewx.ObservingConditions) *float64 { return oc.WindSpeed })},
+	"dewpointdepression": {"°C", -10, 80, 0.1, field(func(oc *weewx.ObservingConditions) *float64 {
+		if oc.Temperature == nil || oc.DewPoint == nil {
+			return nil
+		}
+		v := *oc.Temperature - *oc.DewPoint
+		return &v
+	})},
+	"age": {"s", 0, 86400, 1, func(oc *weewx.ObservingConditions, now time.Time) *float64 {
+		if oc.LastUpdated.IsZero() {
+			return nil
+		}
+		v := now.Sub(oc.LastUpdated).Seconds()
+		return &v
+	}},
+}
+
+// Parse builds the switches from the condition and analog definitions.
+//
+// Conditions are separated by semicolons and have the form name:sensor op
+// value, such as "Windy:windgust>40". The operators are >, >=, < and <=.
+// Analog switches are a comma separated list of sensor names. The sensors are
+// the lower case ObservingConditions property names, plus dewpointdepression
+// (temperature minus dew point) and age (seconds since the last update).
+func Parse(conditions, analog string) ([]Switch, error) {
+	var switches []Switch
+
+	for _, def := range strings.Split(conditions, ";") {
+		def = strings.TrimSpace(def)
+		if def == "" {
+			continue
+		}
+
+		s, err := parseCondition(def)
+		if err != nil {
+			return nil, err
+		}
+
+		switches = append(switches, *s)
+	}
+
+	for _, name := range strings.Split(analog, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		sen, ok := sensors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown sensor %q", name)
+		}
+
+		switches = append(switches, Switch{
+			Name:        name,
+			Description: fmt.Sprintf("%s in %s", name, sen.unit),
+			Min:         sen.min,
+			Max:         sen.max,
+			Step:        sen.step,
+			Value:       sen.value,
+		})
+	}
+
+	return switches, nil
+}
+
+func parseCondition(def string) (*Switch, error) {
+	name, expr, ok := strings.Cut(def, ":")
+	if !ok {
+		return nil, fmt.Errorf("switch condition %q is missing a name", def)
+	}
+
+	name = strings.TrimSpace(name)
+	expr = strings.TrimSpace(expr)
+
+	// Check the two character operators first, so ">=" is not read as ">".
+	for _, op := range []string{">=", "<=", ">", "<"} {
+		sensorName, threshold, ok := strings.Cut(expr, op)
+		if !ok {
+			continue
+		}
+
+		sensorName = strings.ToLower(strings.TrimSpace(sensorName))
+
+		sen, ok := sensors[sensorName]
+		if !ok {
+			return nil, fmt.Errorf("unknown sensor %q in switch condition %q", sensorName, def)
+		}
+
+		limit, err := strconv.ParseFloat(strings.TrimSpace(threshold), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid threshold in switch condition %q", def)
+		}
+
+		compare := comparisons[op]
+
+		return &Switch{
+			Name:        name,
+			Description: fmt.Sprintf("%s %s %g %s", sensorName, op, limit, sen.unit),
+			Min:         0,
+			Max:         1,
+			Step:        1,
+			Value: func(oc *weewx.ObservingConditions, now time.Time) *float64 {
+				v := sen.value(oc, now)
+				if v == nil {
+					return nil
+				}
+
+				on := 0.0
+				if compare(*v, limit) {
+					on = 1
+				}
+				return &on
+			},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("switch condition %q has no comparison", def)
+}
+
+var comparisons = map[string]func(a, b float64) bool{
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+}
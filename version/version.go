@@ -0,0 +1,127 @@
+// Package version describes the build that is running, so that a report of a
+// problem can name it exactly.
+package version
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// These are set at build time with
+//
+//	-ldflags "-X github.com/darkdragonsastro/weewx-json-alpaca/version.version=v1.2.3 ..."
+//
+// and take precedence over the build info Go embeds in the binary.
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// Info describes a build.
+type Info struct {
+	// Version is the release, or "devel" for a build that is not one.
+	Version string `json:"version"`
+	// Commit is the git hash the build is from.
+	Commit string `json:"commit,omitempty"`
+	// Modified is set when the working tree had uncommitted changes.
+	Modified bool `json:"modified,omitempty"`
+	// Date is when the build, or else the commit, was made.
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the version of the running build.
+func Get() Info {
+	info := Info{
+		Version: "devel",
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.GoVersion = bi.GoVersion
+
+		if v := bi.Main.Version; v != "" && v != "(devel)" {
+			info.Version = v
+		}
+
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Commit = s.Value
+			case "vcs.time":
+				info.Date = s.Value
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+
+	if version != "" {
+		info.Version = version
+	}
+	if commit != "" {
+		info.Commit = commit
+		info.Modified = false
+	}
+	if date != "" {
+		info.Date = date
+	}
+
+	return info
+}
+
+// String returns the version with the short commit hash and the date, such
+// as "v1.2.3 (0123abc, 2024-01-02T03:04:05Z)".
+func (i Info) String() string {
+	var details []string
+
+	if i.Commit != "" {
+		c := i.Commit
+		if len(c) > 7 {
+			c = c[:7]
+		}
+		if i.Modified {
+			c += "-dirty"
+		}
+		details = append(details, c)
+	}
+
+	if i.Date != "" {
+		details = append(details, i.Date)
+	}
+
+	if len(details) == 0 {
+		return i.Version
+	}
+
+	return fmt.Sprintf("%s (%s)", i.Version, strings.Join(details, ", "))
+}
+
+// DriverVersion returns the major and minor version in the "m.n" form Alpaca
+// asks for, "0.0" for a build that is not a release.
+func (i Info) DriverVersion() string {
+	parts := strings.SplitN(strings.TrimPrefix(i.Version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return "0.0"
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return "0.0"
+	}
+
+	// The minor version of a pre-release such as v1.2.0-rc.1 is "2".
+	minorPart := parts[1]
+	if n := strings.IndexFunc(minorPart, func(r rune) bool { return r < '0' || r > '9' }); n >= 0 {
+		minorPart = minorPart[:n]
+	}
+
+	minor, err := strconv.Atoi(minorPart)
+	if err != nil {
+		return "0.0"
+	}
+
+	return fmt.Sprintf("%d.%d", major, minor)
+}
@@ -0,0 +1,41 @@
+package weewx
+
+import "math"
+
+// Calibration holds offsets added to the readings of the station, in the
+// units they are served in, to correct sensors that read high or low.
+type Calibration struct {
+	// Temperature is in °C.
+	Temperature float64 `json:"temperature"`
+	// Humidity is in percent.
+	Humidity float64 `json:"humidity"`
+	// Pressure is in hPa.
+	Pressure float64 `json:"pressure"`
+	// SkyTemperature is in °C.
+	SkyTemperature float64 `json:"sky_temperature"`
+	// SkyQuality is in mag/arcsec².
+	SkyQuality float64 `json:"sky_quality"`
+}
+
+// apply adds the offset to the value, when there is one.
+func apply(v *float64, offset float64) *float64 {
+	if v == nil || offset == 0 {
+		return v
+	}
+
+	calibrated := *v + offset
+	return &calibrated
+}
+
+// calibrate corrects the station readings, before anything is derived from
+// them. The humidity is kept between 0 and 100%.
+func (c Calibration) calibrate(oc *ObservingConditions) {
+	oc.Temperature = apply(oc.Temperature, c.Temperature)
+	oc.Pressure = apply(oc.Pressure, c.Pressure)
+
+	oc.Humidity = apply(oc.Humidity, c.Humidity)
+	if oc.Humidity != nil {
+		humidity := math.Max(0, math.Min(100, *oc.Humidity))
+		oc.Humidity = &humidity
+	}
+}
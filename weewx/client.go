@@ -2,28 +2,48 @@
 package weewx
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/darkdragonsastro/weewx-json-alpaca/httputil"
+	"github.com/darkdragonsastro/weewx-json-alpaca/sqm"
 )
 
 type ObservingConditions struct {
-	Connected     bool
-	AveragePeriod float64
-	DewPoint      *float64
-	Humidity      *float64
-	Pressure      *float64
-	RainRate      *float64
-	Temperature   *float64
-	WindDirection *float64
-	WindGust      *float64
-	WindSpeed     *float64
-	LastUpdated   time.Time
+	Connected      bool
+	AveragePeriod  float64
+	DewPoint       *float64
+	Humidity       *float64
+	Pressure       *float64
+	RainRate       *float64
+	SkyTemperature *float64
+	CloudCover     *float64
+	SkyQuality     *float64
+	SkyBrightness  *float64
+	Temperature    *float64
+	WindDirection  *float64
+	WindGust       *float64
+	WindSpeed      *float64
+	LastUpdated    time.Time
+
+	// DewPointDerived and HumidityDerived are set when the value was computed
+	// rather than reported by the station.
+	DewPointDerived bool
+	HumidityDerived bool
+
+	// CloudCoverFromCamera is set when the cloud cover was estimated from the
+	// all-sky camera.
+	CloudCoverFromCamera bool
 }
 
 type Station struct {
@@ -123,6 +143,16 @@ func (v *Value) AsDirection() *float64 {
 	return &v.Value
 }
 
+// AsSkyQuality returns the value in mag/arcsec². SQM extensions do not agree
+// on a unit label, so any unit is accepted.
+func (v *Value) AsSkyQuality() *float64 {
+	if v == nil {
+		return nil
+	}
+
+	return &v.Value
+}
+
 func (v *Value) AsSpeed() *float64 {
 	if v == nil {
 		return nil
@@ -172,6 +202,73 @@ type Current struct {
 	RainRate          *Value `json:"rain rate"`
 	InsideTemperature *Value `json:"inside temperature"`
 	InsideHumidity    *Value `json:"inside humidity"`
+
+	// Fields holds every value in the current section by its WeeWX name,
+	// including those added by extensions.
+	Fields map[string]*Value `json:"-"`
+}
+
+func (c *Current) UnmarshalJSON(b []byte) error {
+	type current Current
+
+	var cc current
+	err := json.Unmarshal(b, &cc)
+	if err != nil {
+		return err
+	}
+
+	var raw map[string]json.RawMessage
+	err = json.Unmarshal(b, &raw)
+	if err != nil {
+		return err
+	}
+
+	cc.Fields = make(map[string]*Value, len(raw))
+	for k, v := range raw {
+		var val Value
+		if json.Unmarshal(v, &val) == nil {
+			cc.Fields[k] = &val
+		}
+	}
+
+	*c = Current(cc)
+
+	return nil
+}
+
+// standardFields are the fields that are served as ObservingConditions
+// properties.
+var standardFields = map[string]bool{
+	"temperature":    true,
+	"dewpoint":       true,
+	"humidity":       true,
+	"barometer":      true,
+	"wind speed":     true,
+	"wind gust":      true,
+	"wind direction": true,
+	"rain rate":      true,
+}
+
+// Extras returns the fields that are not served as ObservingConditions
+// properties, such as the heat index, wind chill and extension fields.
+func (c *Current) Extras() map[string]*Value {
+	extras := make(map[string]*Value)
+	for k, v := range c.Fields {
+		if !standardFields[k] {
+			extras[k] = v
+		}
+	}
+
+	return extras
+}
+
+// Field returns the value of the named field, or nil when it is not present.
+func (c *Current) Field(name string) *Value {
+	if name == "" {
+		return nil
+	}
+
+	return c.Fields[name]
 }
 
 type WeeWx struct {
@@ -180,16 +277,77 @@ type WeeWx struct {
 	Current    Current    `json:"current"`
 }
 
-type Client struct {
-	Url string
-	c   *http.Client
-	log *zap.Logger
+// DefaultInterval is how often the report is fetched unless set otherwise.
+const DefaultInterval = 5 * time.Second
+
+// Options controls how the client turns the WeeWX report into observing
+// conditions.
+type Options struct {
+	// Interval is how often the report is fetched. It defaults to
+	// DefaultInterval.
+	Interval time.Duration
+
+	// AlwaysDeriveDewPoint computes the dew point from temperature and humidity
+	// even when the station reports one.
+	AlwaysDeriveDewPoint bool
+
+	// SkyTemperatureField is the name of the WeeWX field holding the sky
+	// temperature, usually from an IR sensor such as the MLX90614. Sky
+	// temperature and cloud cover are only available when this is set.
+	SkyTemperatureField string
+	// CloudModel converts the sky temperature into cloud cover.
+	CloudModel CloudModel
+
+	// SkyQualityField is the name of the WeeWX field holding the sky quality
+	// in mag/arcsec², as reported by an SQM extension.
+	SkyQualityField string
+	// SkyQualityMeter reads the sky quality directly from a meter. When set,
+	// it takes precedence over SkyQualityField.
+	SkyQualityMeter SkyQualityMeter
+
+	// SkyCamera provides the cloud cover when it is not available from the
+	// sky temperature.
+	SkyCamera SkyCamera
+
+	// Calibration corrects the readings of the station and the sky quality
+	// meter.
+	Calibration Calibration
+}
 
-	val  *atomic.Value
-	done chan bool
+// SkyCamera estimates conditions from all-sky camera frames. The values are
+// nil when there is no recent frame. The camera's sky brightness is not used:
+// it depends on the exposure and is not a brightness in lux.
+type SkyCamera interface {
+	// CloudCover returns the cloud cover in percent.
+	CloudCover() *float64
 }
 
-func NewClient(url string, log *zap.Logger) *Client {
+// SkyQualityMeter is a device that measures the sky quality in mag/arcsec².
+type SkyQualityMeter interface {
+	SkyQuality() (float64, error)
+}
+
+type Client struct {
+	Url  string
+	c    *http.Client
+	log  *zap.Logger
+	opts Options
+
+	// cfgMu guards Url and opts, which Configure changes while running.
+	cfgMu       sync.RWMutex
+	reconfigure chan struct{}
+
+	val      *atomic.Value
+	interior *atomic.Value
+	report   atomic.Pointer[report]
+
+	mu         sync.Mutex
+	cancel     context.CancelFunc
+	stopped    chan struct{}
+	connecting atomic.Bool
+}
+
+func NewClient(url string, opts Options, log *zap.Logger) *Client {
 	c := &http.Client{
 		Timeout:   10 * time.Second,
 		Transport: httputil.DefaultLogTransport(log, httputil.LogTransport(http.DefaultTransport)),
@@ -200,23 +358,150 @@ func NewClient(url string, log *zap.Logger) *Client {
 		Connected: false,
 	})
 
+	interior := &atomic.Value{}
+	interior.Store(&ObservingConditions{
+		Connected: false,
+	})
+
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+
 	return &Client{
-		Url:  url,
-		c:    c,
-		log:  log,
-		val:  val,
-		done: make(chan bool),
+		Url:         url,
+		c:           c,
+		log:         log,
+		opts:        opts,
+		reconfigure: make(chan struct{}, 1),
+		val:         val,
+		interior:    interior,
+	}
+}
+
+// report is a report fetched from WeeWX, parsed and as received.
+type report struct {
+	weewx *WeeWx
+	raw   []byte
+}
+
+// Report returns the last report fetched from WeeWX, parsed and as received.
+// Both are nil before the first successful fetch.
+func (c *Client) Report() (*WeeWx, []byte) {
+	r := c.report.Load()
+	if r == nil {
+		return nil, nil
+	}
+
+	return r.weewx, r.raw
+}
+
+// Settings are the parts of the client configuration that can be changed
+// while it is running.
+type Settings struct {
+	URL                  string        `json:"url"`
+	Interval             time.Duration `json:"interval"`
+	AlwaysDeriveDewPoint bool          `json:"always_derive_dewpoint"`
+	SkyTemperatureField  string        `json:"sky_temperature_field"`
+	SkyQualityField      string        `json:"sky_quality_field"`
+	CloudModel           CloudModel    `json:"cloud_model"`
+	Calibration          Calibration   `json:"calibration"`
+}
+
+// Validate reports the first problem with the settings.
+func (s Settings) Validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("weewx url %q must be an http or https URL", s.URL)
+	}
+
+	if s.Interval < time.Second || s.Interval > time.Hour {
+		return errors.New("poll interval must be between 1s and 1h")
+	}
+
+	if s.CloudModel.ClearThreshold >= s.CloudModel.OvercastThreshold {
+		return errors.New("clear threshold must be below the overcast threshold")
+	}
+
+	return nil
+}
+
+// Settings returns the current settings.
+func (c *Client) Settings() Settings {
+	c.cfgMu.RLock()
+	defer c.cfgMu.RUnlock()
+
+	return Settings{
+		URL:                  c.Url,
+		Interval:             c.opts.Interval,
+		AlwaysDeriveDewPoint: c.opts.AlwaysDeriveDewPoint,
+		SkyTemperatureField:  c.opts.SkyTemperatureField,
+		SkyQualityField:      c.opts.SkyQualityField,
+		CloudModel:           c.opts.CloudModel,
+		Calibration:          c.opts.Calibration,
+	}
+}
+
+// Configure validates and applies the settings. A running client fetches the
+// report again straight away.
+func (c *Client) Configure(s Settings) error {
+	err := s.Validate()
+	if err != nil {
+		return err
+	}
+
+	c.cfgMu.Lock()
+	c.Url = s.URL
+	c.opts.Interval = s.Interval
+	c.opts.AlwaysDeriveDewPoint = s.AlwaysDeriveDewPoint
+	c.opts.SkyTemperatureField = s.SkyTemperatureField
+	c.opts.SkyQualityField = s.SkyQualityField
+	c.opts.CloudModel = s.CloudModel
+	c.opts.Calibration = s.Calibration
+	c.cfgMu.Unlock()
+
+	c.log.Info("weewx client reconfigured", zap.String("url", s.URL), zap.Duration("interval", s.Interval))
+
+	select {
+	case c.reconfigure <- struct{}{}:
+	default:
 	}
+
+	return nil
 }
 
-func (c *Client) refresh() (*WeeWx, error) {
-	resp, err := c.c.Get(c.Url)
+// config returns the current URL and options.
+func (c *Client) config() (string, Options) {
+	c.cfgMu.RLock()
+	defer c.cfgMu.RUnlock()
+
+	return c.Url, c.opts
+}
+
+func (c *Client) refresh(ctx context.Context) (*WeeWx, error) {
+	u, opts := c.config()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	raw, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
 	var weewx WeeWx
-	err = json.NewDecoder(resp.Body).Decode(&weewx)
+	err = json.Unmarshal(raw, &weewx)
 	if err != nil {
 		return nil, err
 	}
@@ -235,46 +520,169 @@ func (c *Client) refresh() (*WeeWx, error) {
 		LastUpdated:   weewx.Generation.Time.Time,
 	}
 
+	opts.Calibration.calibrate(&conditions)
+	conditions.derive(opts.AlwaysDeriveDewPoint)
+
+	conditions.SkyTemperature = apply(weewx.Current.Field(opts.SkyTemperatureField).AsTemperature(), opts.Calibration.SkyTemperature)
+	if conditions.SkyTemperature != nil && conditions.Temperature != nil {
+		cloudCover := opts.CloudModel.CloudCover(*conditions.SkyTemperature, *conditions.Temperature)
+		conditions.CloudCover = &cloudCover
+	}
+
+	conditions.SkyQuality = apply(c.skyQuality(&weewx, opts), opts.Calibration.SkyQuality)
+	if conditions.SkyQuality != nil {
+		skyBrightness := sqm.Lux(*conditions.SkyQuality)
+		conditions.SkyBrightness = &skyBrightness
+	}
+
+	if opts.SkyCamera != nil && conditions.CloudCover == nil {
+		conditions.CloudCover = opts.SkyCamera.CloudCover()
+		conditions.CloudCoverFromCamera = conditions.CloudCover != nil
+	}
+
 	c.val.Store(&conditions)
+	c.interior.Store(interiorConditions(&weewx))
+	c.report.Store(&report{weewx: &weewx, raw: raw})
 
 	return &weewx, nil
 }
 
+func (c *Client) skyQuality(weewx *WeeWx, opts Options) *float64 {
+	if opts.SkyQualityMeter == nil {
+		return weewx.Current.Field(opts.SkyQualityField).AsSkyQuality()
+	}
+
+	skyQuality, err := opts.SkyQualityMeter.SkyQuality()
+	if err != nil {
+		c.log.Error("error reading sky quality meter", zap.Error(err))
+		return nil
+	}
+
+	return &skyQuality
+}
+
+// Supports reports whether the client is configured to provide the named
+// sensor. The name is the lower case Alpaca property name.
+func (c *Client) Supports(sensor string) bool {
+	_, opts := c.config()
+
+	switch sensor {
+	case "cloudcover":
+		return opts.SkyTemperatureField != "" || opts.SkyCamera != nil
+	case "skytemperature":
+		return opts.SkyTemperatureField != ""
+	case "skybrightness":
+		return opts.SkyQualityMeter != nil || opts.SkyQualityField != ""
+	case "skyquality":
+		return opts.SkyQualityMeter != nil || opts.SkyQualityField != ""
+	case "starfwhm":
+		return false
+	}
+
+	return true
+}
+
 func (c *Client) GetCurrent() *ObservingConditions {
 	conditions := c.val.Load().(*ObservingConditions)
 	return conditions
 }
 
+// Start fetches the report and then polls it in the background until Stop is
+// called. Starting a running client does nothing.
 func (c *Client) Start() {
-	c.refresh()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	timer := time.NewTicker(5 * time.Second)
+	if c.cancel != nil {
+		return
+	}
 
 	c.log.Info("starting weewx client")
 
-	go func() {
-		for range timer.C {
-			select {
-			case <-c.done:
-				c.val.Store(&ObservingConditions{
-					Connected: false,
-				})
-
-				timer.Stop()
-
-				c.log.Info("stopping weewx client")
-
-				return
-			case <-timer.C:
-				_, err := c.refresh()
-				if err != nil {
-					c.log.Error("error getting weewx", zap.Error(err))
-				}
+	_, err := c.refresh(context.Background())
+	if err != nil {
+		c.log.Error("error getting weewx", zap.Error(err))
+	}
+
+	var ctx context.Context
+	ctx, c.cancel = context.WithCancel(context.Background())
+	c.stopped = make(chan struct{})
+
+	go c.poll(ctx, c.stopped)
+}
+
+// poll refreshes the conditions until ctx is canceled. A refresh in flight is
+// abandoned then, so that stopping never waits for a slow WeeWX server.
+func (c *Client) poll(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+
+	_, opts := c.config()
+
+	timer := time.NewTimer(opts.Interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-c.reconfigure:
+			if !timer.Stop() {
+				<-timer.C
 			}
 		}
-	}()
+
+		_, err := c.refresh(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			c.log.Error("error getting weewx", zap.Error(err))
+		}
+
+		_, opts = c.config()
+		timer.Reset(opts.Interval)
+	}
 }
 
+// Stop stops polling and marks the conditions as disconnected. Stopping a
+// client that is not running does nothing.
 func (c *Client) Stop() {
-	c.done <- true
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cancel == nil {
+		return
+	}
+
+	c.cancel()
+	<-c.stopped
+
+	c.cancel = nil
+	c.stopped = nil
+
+	c.val.Store(&ObservingConditions{
+		Connected: false,
+	})
+	c.interior.Store(&ObservingConditions{
+		Connected: false,
+	})
+
+	c.log.Info("stopping weewx client")
+}
+
+// Connect starts the client in the background. Connecting reports true until
+// the first report has been fetched.
+func (c *Client) Connect() {
+	c.connecting.Store(true)
+
+	go func() {
+		c.Start()
+		c.connecting.Store(false)
+	}()
+}
+
+// Connecting reports whether a Connect is still in progress.
+func (c *Client) Connecting() bool {
+	return c.connecting.Load()
 }
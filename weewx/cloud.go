@@ -0,0 +1,87 @@
+package weewx
+
+import "math"
+
+// CloudModel holds the coefficients of the AAG CloudWatcher / Boltwood
+// clear-sky model. The model estimates the sky temperature expected for a
+// clear sky at the current ambient temperature. The difference between the
+// measured and the expected sky temperature is then mapped to a cloud cover
+// percentage between ClearThreshold and OvercastThreshold.
+type CloudModel struct {
+	K1 float64 `json:"k1"`
+	K2 float64 `json:"k2"`
+	K3 float64 `json:"k3"`
+	K4 float64 `json:"k4"`
+	K5 float64 `json:"k5"`
+	K6 float64 `json:"k6"`
+	K7 float64 `json:"k7"`
+
+	// ClearThreshold is the corrected sky temperature in °C at or below which
+	// the sky is considered clear (0%).
+	ClearThreshold float64 `json:"clear_threshold"`
+	// OvercastThreshold is the corrected sky temperature in °C at or above
+	// which the sky is considered overcast (100%).
+	OvercastThreshold float64 `json:"overcast_threshold"`
+}
+
+// DefaultCloudModel returns the coefficients recommended by AAG for the
+// CloudWatcher.
+func DefaultCloudModel() CloudModel {
+	return CloudModel{
+		K1:                33,
+		K2:                0,
+		K3:                4,
+		K4:                100,
+		K5:                100,
+		K6:                0,
+		K7:                0,
+		ClearThreshold:    -15,
+		OvercastThreshold: 0,
+	}
+}
+
+// ClearSkyTemperature returns the expected clear sky temperature difference
+// Td for the given ambient temperature in °C.
+func (m CloudModel) ClearSkyTemperature(ambient float64) float64 {
+	k2 := m.K2 / 10
+	delta := ambient - k2
+
+	td := (m.K1/100)*delta + (m.K3/100)*math.Pow(math.Exp(m.K4/1000*ambient), m.K5/100)
+
+	if math.Abs(delta) < 1 {
+		td += sign(m.K6) * sign(delta) * math.Abs(delta)
+	} else {
+		td += m.K6 / 10 * sign(delta) * (math.Log10(math.Abs(delta)) + m.K7/100)
+	}
+
+	return td
+}
+
+// CloudCover estimates the cloud cover in percent from the sky and ambient
+// temperatures in °C.
+func (m CloudModel) CloudCover(sky, ambient float64) float64 {
+	corrected := sky - m.ClearSkyTemperature(ambient)
+
+	if m.OvercastThreshold <= m.ClearThreshold {
+		if corrected > m.ClearThreshold {
+			return 100
+		}
+		return 0
+	}
+
+	cover := (corrected - m.ClearThreshold) / (m.OvercastThreshold - m.ClearThreshold) * 100
+
+	return math.Max(0, math.Min(100, cover))
+}
+
+func sign(v float64) float64 {
+	if v < 0 {
+		return -1
+	}
+
+	if v > 0 {
+		return 1
+	}
+
+	return 0
+}
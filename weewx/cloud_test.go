@@ -0,0 +1,69 @@
+package weewx
+
+import (
+	"math"
+	"testing"
+)
+
+func TestClearSkyTemperature(t *testing.T) {
+	tests := []struct {
+		name    string
+		model   CloudModel
+		ambient float64
+		want    float64
+	}{
+		// With the AAG defaults, Td = 0.33 T + 0.04 exp(0.1 T).
+		{"defaults at 0°C", DefaultCloudModel(), 0, 0.04},
+		{"defaults at 20°C", DefaultCloudModel(), 20, 6.6 + 0.04*math.Exp(2)},
+		{"defaults at -10°C", DefaultCloudModel(), -10, -3.3 + 0.04*math.Exp(-1)},
+		// K2 shifts the linear term by K2/10 °C.
+		{"K2", CloudModel{K1: 33, K2: 100}, 20, 0.33 * 10},
+		// K4 and K5 scale the exponential term.
+		{"K4 and K5", CloudModel{K3: 10, K4: 50, K5: 200}, 10, 0.1 * math.Exp(1)},
+		// K6 and K7 add a logarithmic term away from K2/10...
+		{"K6 and K7", CloudModel{K6: 20, K7: 50}, 100, 2 * (2 + 0.5)},
+		{"K6 below K2", CloudModel{K6: 20, K7: 50}, -100, -2 * (2 + 0.5)},
+		// ...and a linear one within 1°C of it.
+		{"K6 near K2", CloudModel{K2: 100, K6: 20}, 10.5, 0.5},
+		{"K6 just below K2", CloudModel{K2: 100, K6: 20}, 9.5, -0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.model.ClearSkyTemperature(tt.ambient); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("ClearSkyTemperature(%g) = %g, want %g", tt.ambient, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloudCover(t *testing.T) {
+	m := DefaultCloudModel()
+
+	// At 0°C the clear sky is expected 0.04°C above ambient, and the default
+	// thresholds map -15°C..0°C above that to 0..100%.
+	td := m.ClearSkyTemperature(0)
+
+	tests := []struct {
+		name  string
+		model CloudModel
+		sky   float64
+		want  float64
+	}{
+		{"clear", m, td - 15, 0},
+		{"clamped at clear", m, td - 40, 0},
+		{"half", m, td - 7.5, 50},
+		{"overcast", m, td, 100},
+		{"clamped at overcast", m, td + 10, 100},
+		{"equal thresholds, clear", CloudModel{ClearThreshold: -10, OvercastThreshold: -10}, -10, 0},
+		{"equal thresholds, overcast", CloudModel{ClearThreshold: -10, OvercastThreshold: -10}, -9, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.model.CloudCover(tt.sky, 0); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("CloudCover(%g, 0) = %g, want %g", tt.sky, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package weewx
+
+import "math"
+
+// Magnus-Tetens coefficients (Sonntag 1990), valid from -45°C to 60°C.
+const (
+	magnusA = 17.62
+	magnusB = 243.12
+)
+
+// DewPointFromHumidity computes the dew point in °C from the temperature in °C
+// and the relative humidity in percent using the Magnus-Tetens formula.
+func DewPointFromHumidity(temperature, humidity float64) *float64 {
+	if humidity <= 0 || humidity > 100 {
+		return nil
+	}
+
+	gamma := math.Log(humidity/100) + magnusA*temperature/(magnusB+temperature)
+	dewPoint := magnusB * gamma / (magnusA - gamma)
+
+	return &dewPoint
+}
+
+// HumidityFromDewPoint computes the relative humidity in percent from the
+// temperature and dew point in °C. This is the inverse of DewPointFromHumidity.
+func HumidityFromDewPoint(temperature, dewPoint float64) *float64 {
+	humidity := 100 * math.Exp(magnusA*dewPoint/(magnusB+dewPoint)-magnusA*temperature/(magnusB+temperature))
+	humidity = math.Min(humidity, 100)
+
+	return &humidity
+}
+
+// derive fills in the dew point and humidity when one of them is missing but
+// can be computed from the temperature and the other. When alwaysDeriveDewPoint
+// is set, the dew point is computed even if the station reported one.
+func (oc *ObservingConditions) derive(alwaysDeriveDewPoint bool) {
+	if oc.Temperature == nil {
+		return
+	}
+
+	if oc.Humidity != nil && (oc.DewPoint == nil || alwaysDeriveDewPoint) {
+		if dewPoint := DewPointFromHumidity(*oc.Temperature, *oc.Humidity); dewPoint != nil {
+			oc.DewPoint = dewPoint
+			oc.DewPointDerived = true
+		}
+		return
+	}
+
+	if oc.Humidity == nil && oc.DewPoint != nil {
+		oc.Humidity = HumidityFromDewPoint(*oc.Temperature, *oc.DewPoint)
+		oc.HumidityDerived = true
+	}
+}
@@ -0,0 +1,148 @@
+package weewx
+
+import (
+	"math"
+	"testing"
+)
+
+// Dew points over water from published psychrometric tables, rounded to
+// 0.1°C.
+var dewPointTable = []struct {
+	temperature, humidity, dewPoint float64
+}{
+	{0, 100, 0},
+	{-10, 80, -12.8},
+	{10, 90, 8.4},
+	{20, 50, 9.3},
+	{25, 60, 16.7},
+	{30, 70, 23.9},
+	{35, 40, 19.4},
+}
+
+func TestDewPointFromHumidity(t *testing.T) {
+	for _, tt := range dewPointTable {
+		dewPoint := DewPointFromHumidity(tt.temperature, tt.humidity)
+		if dewPoint == nil {
+			t.Errorf("DewPointFromHumidity(%g, %g) = nil", tt.temperature, tt.humidity)
+			continue
+		}
+
+		if math.Abs(*dewPoint-tt.dewPoint) > 0.05 {
+			t.Errorf("DewPointFromHumidity(%g, %g) = %.2f, want %.1f", tt.temperature, tt.humidity, *dewPoint, tt.dewPoint)
+		}
+	}
+
+	for _, humidity := range []float64{0, -5, 101} {
+		if dewPoint := DewPointFromHumidity(20, humidity); dewPoint != nil {
+			t.Errorf("DewPointFromHumidity(20, %g) = %g, want nil", humidity, *dewPoint)
+		}
+	}
+}
+
+func TestHumidityFromDewPoint(t *testing.T) {
+	for _, tt := range dewPointTable {
+		humidity := HumidityFromDewPoint(tt.temperature, tt.dewPoint)
+
+		// The table's dew points are rounded, which moves the humidity by
+		// up to about half a percent.
+		if math.Abs(*humidity-tt.humidity) > 0.5 {
+			t.Errorf("HumidityFromDewPoint(%g, %g) = %.2f, want %g", tt.temperature, tt.dewPoint, *humidity, tt.humidity)
+		}
+	}
+
+	if humidity := HumidityFromDewPoint(10, 12); *humidity != 100 {
+		t.Errorf("HumidityFromDewPoint with the dew point above the temperature = %g, want 100", *humidity)
+	}
+}
+
+func TestDewPointRoundTrip(t *testing.T) {
+	for temperature := -40.0; temperature <= 50; temperature += 5 {
+		for humidity := 5.0; humidity <= 100; humidity += 5 {
+			dewPoint := DewPointFromHumidity(temperature, humidity)
+			got := HumidityFromDewPoint(temperature, *dewPoint)
+
+			if math.Abs(*got-humidity) > 1e-9 {
+				t.Errorf("%g°C %g%%: dew point %g gives back %g%%", temperature, humidity, *dewPoint, *got)
+			}
+		}
+	}
+}
+
+func TestDerive(t *testing.T) {
+	v := func(f float64) *float64 { return &f }
+
+	tests := []struct {
+		name                 string
+		oc                   ObservingConditions
+		alwaysDeriveDewPoint bool
+
+		dewPoint, humidity *float64
+		dewPointDerived    bool
+		humidityDerived    bool
+	}{
+		{
+			name:            "missing dew point",
+			oc:              ObservingConditions{Temperature: v(20), Humidity: v(50)},
+			dewPoint:        v(9.26),
+			humidity:        v(50),
+			dewPointDerived: true,
+		},
+		{
+			name:            "missing humidity",
+			oc:              ObservingConditions{Temperature: v(20), DewPoint: v(9.26)},
+			dewPoint:        v(9.26),
+			humidity:        v(50),
+			humidityDerived: true,
+		},
+		{
+			name:     "both reported",
+			oc:       ObservingConditions{Temperature: v(20), Humidity: v(50), DewPoint: v(9)},
+			dewPoint: v(9),
+			humidity: v(50),
+		},
+		{
+			name:                 "always derive dew point",
+			oc:                   ObservingConditions{Temperature: v(20), Humidity: v(50), DewPoint: v(9)},
+			alwaysDeriveDewPoint: true,
+			dewPoint:             v(9.26),
+			humidity:             v(50),
+			dewPointDerived:      true,
+		},
+		{
+			name:     "no temperature",
+			oc:       ObservingConditions{Humidity: v(50)},
+			humidity: v(50),
+		},
+	}
+
+	same := func(got, want *float64) bool {
+		if got == nil || want == nil {
+			return got == want
+		}
+		return math.Abs(*got-*want) < 0.05
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oc := tt.oc
+			oc.derive(tt.alwaysDeriveDewPoint)
+
+			if !same(oc.DewPoint, tt.dewPoint) || oc.DewPointDerived != tt.dewPointDerived {
+				t.Errorf("dew point %v derived %t, want %v derived %t", deref(oc.DewPoint), oc.DewPointDerived, deref(tt.dewPoint), tt.dewPointDerived)
+			}
+
+			if !same(oc.Humidity, tt.humidity) || oc.HumidityDerived != tt.humidityDerived {
+				t.Errorf("humidity %v derived %t, want %v derived %t", deref(oc.Humidity), oc.HumidityDerived, deref(tt.humidity), tt.humidityDerived)
+			}
+		})
+	}
+}
+
+// deref returns the value for printing, or nil.
+func deref(f *float64) any {
+	if f == nil {
+		return nil
+	}
+
+	return *f
+}
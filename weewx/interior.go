@@ -0,0 +1,65 @@
+package weewx
+
+// Interior serves the inside temperature and humidity reported by the
+// station as separate observing conditions, such as for an observatory
+// interior. The dew point is always derived.
+type Interior struct {
+	c *Client
+}
+
+// Interior returns the interior conditions of the station. They are updated
+// along with the outside conditions.
+func (c *Client) Interior() *Interior {
+	return &Interior{
+		c: c,
+	}
+}
+
+func interiorConditions(weewx *WeeWx) *ObservingConditions {
+	conditions := ObservingConditions{
+		Connected:   true,
+		Humidity:    weewx.Current.InsideHumidity.AsPercent(),
+		Temperature: weewx.Current.InsideTemperature.AsTemperature(),
+		LastUpdated: weewx.Generation.Time.Time,
+	}
+
+	conditions.derive(true)
+
+	return &conditions
+}
+
+// Supports reports whether the named sensor is available. Only temperature,
+// humidity and dew point are measured inside.
+func (i *Interior) Supports(sensor string) bool {
+	switch sensor {
+	case "temperature", "humidity", "dewpoint":
+		return true
+	}
+
+	return false
+}
+
+func (i *Interior) GetCurrent() *ObservingConditions {
+	conditions := i.c.interior.Load().(*ObservingConditions)
+	return conditions
+}
+
+// Report returns the report of the client the interior conditions come from.
+func (i *Interior) Report() (*WeeWx, []byte) {
+	return i.c.Report()
+}
+
+// Start, Stop and Connect do nothing: the client the interior conditions come
+// from is shared with the outside conditions and runs for as long as they
+// are served, so disconnecting the interior device must not stop it.
+
+func (i *Interior) Start() {}
+
+func (i *Interior) Stop() {}
+
+func (i *Interior) Connect() {}
+
+// Connecting reports whether the shared client is still connecting.
+func (i *Interior) Connecting() bool {
+	return i.c.Connecting()
+}